@@ -0,0 +1,170 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the apply command
+var (
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Apply manifests to the cluster",
+		Long: `Create and update users, caps, quotas and bucket owners to match
+YAML manifests. Only the fields set in a manifest are changed.
+
+kind: User
+uid: alice
+displayName: Alice
+email: alice@example.com
+maxBuckets: 100
+suspended: false
+caps: ["buckets=*", "users=read"]
+quota: {enabled: true, maxSize: 500G, maxObjects: 1000000}
+bucketQuota: {enabled: true, maxSize: 50G}
+---
+kind: UserCaps      # the complete caps of an existing user
+uid: bob
+caps: ["usage=read"]
+---
+kind: UserQuota
+uid: bob
+enabled: true
+maxSize: 1T
+---
+kind: BucketQuota   # quota of a bucket, or with uid the user default bucket quota
+bucket: logs
+enabled: true
+maxObjects: 100000
+---
+kind: Bucket        # owner of an existing bucket
+bucket: logs
+owner: alice
+
+cephmgr apply -f manifests/ --dry-run`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(manifestFiles) == 0 {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := applyManifests(manifestFiles)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringSliceVarP(&manifestFiles, "filename", "f", nil, "Manifest file or directory, - for stdin")
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show changes without applying them")
+	applyCmd.MarkFlagRequired("filename")
+}
+
+func applyManifests(paths []string) error {
+	objects, err := readManifests(paths)
+	if err != nil {
+		return err
+	}
+	sortManifests(objects)
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	results := applyResultList{}
+	for _, o := range objects {
+		results = append(results, applyObject(c, o))
+	}
+
+	if err := printResource(results); err != nil {
+		return err
+	}
+	if failed := results.failed(); failed > 0 {
+		return fmt.Errorf("%w: %d of %d objects", errBulkFailed, failed, len(objects))
+	}
+	return nil
+}
+
+func applyObject(c *admin.API, o manifestObject) applyResult {
+	result := applyResult{Object: o.ref()}
+	current, err := o.current(c)
+	if err != nil {
+		result.Action = "failed"
+		result.Changes = []string{err.Error()}
+		return result
+	}
+
+	result.Changes = manifestChanges(o, current)
+	switch {
+	case len(result.Changes) == 0:
+		result.Action = "unchanged"
+		return result
+	case current == nil:
+		result.Action = "created"
+	default:
+		result.Action = "configured"
+	}
+	if dryRun {
+		result.Action += " (dry run)"
+		return result
+	}
+	if err := o.apply(c, current); err != nil {
+		result.Action = "failed"
+		result.Changes = []string{err.Error()}
+	}
+	return result
+}
+
+type applyResult struct {
+	Object  string   `json:"object"`
+	Action  string   `json:"action"`
+	Changes []string `json:"changes"`
+}
+
+type applyResultList []applyResult
+
+func (l applyResultList) table() table {
+	t := table{headers: []string{"Object", "Action", "Changes"}}
+	for _, r := range l {
+		t.rows = append(t.rows, []string{r.Object, r.Action, strings.Join(r.Changes, "; ")})
+	}
+	return t
+}
+
+func (l applyResultList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, r := range l {
+		names = append(names, r.Object)
+	}
+	return names
+}
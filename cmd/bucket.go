@@ -5,9 +5,13 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
-	"text/tabwriter"
+	"sort"
+	"strconv"
 
 	"github.com/ceph/go-ceph/rgw/admin"
 	"github.com/spf13/cobra"
@@ -26,7 +30,11 @@ var (
 	listBucketsCmd = &cobra.Command{
 		Use:   "list",
 		Short: "Get a list of buckets",
-		Long:  `get list of buckets.`,
+		Long: `Get list of buckets, optionally with size and object counts.
+
+Sorting by size, objects or created implies --stats, e.g. the ten biggest buckets:
+
+cephmgr rgw bucket list --sort size --top 10`,
 		Run: func(cmd *cobra.Command, args []string) {
 			err := listBuckets()
 			if err != nil {
@@ -38,14 +46,16 @@ var (
 	getBucketInfoCmd = &cobra.Command{
 		Use:   "info",
 		Short: "Get bucket details",
-		Long:  `Get bucket details`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Get bucket details: owner, placement, shards, versioning, size and
+object counts per category, and bucket quota.
+
+cephmgr rgw bucket info logs`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			bucket := &Bucket{
-				ID: args[0],
+				Bucket: args[0],
 			}
-			fmt.Println("args 0", args[0])
-			if bucket.ID == "" {
+			if bucket.Bucket == "" {
 				fmt.Printf("error: %s\n", errMissingBucketID)
 				cmd.Help()
 				os.Exit(1)
@@ -63,44 +73,230 @@ func init() {
 	rgwCmd.AddCommand(bucketCmd)
 	bucketCmd.AddCommand(listBucketsCmd)
 	bucketCmd.AddCommand(getBucketInfoCmd)
+
+	listBucketsCmd.Flags().BoolVar(&bucketStats, "stats", false, "Show size and object counts")
+	listBucketsCmd.Flags().StringVar(&bucketOwner, "owner", "", "List only buckets owned by user")
+	listBucketsCmd.Flags().StringVar(&bucketSort, "sort", "", "Sort by size|objects|name|created")
+	listBucketsCmd.Flags().IntVar(&bucketTop, "top", 0, "Show only the first N buckets")
 }
 
 func listBuckets() error {
-	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
-	if err != nil {
-		return err
+	switch bucketSort {
+	case "", "name":
+	case "size", "objects", "created":
+		bucketStats = true
+	default:
+		return fmt.Errorf("%w: %s", errInvalidSort, bucketSort)
 	}
-	buckets, err := c.ListBuckets(context.Background())
 
-	if err != nil {
-		return err
+	if bucketStats {
+		buckets, err := listBucketStats(bucketOwner)
+		if err != nil {
+			return err
+		}
+		sortBuckets(buckets, bucketSort)
+		if bucketTop > 0 && bucketTop < len(buckets) {
+			buckets = buckets[:bucketTop]
+		}
+		return printResource(buckets)
+	}
+
+	var buckets []string
+	if bucketOwner != "" {
+		body, err := adminCall(context.Background(), http.MethodGet, "/bucket", url.Values{"uid": {bucketOwner}})
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &buckets); err != nil {
+			return err
+		}
+	} else {
+		c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+		if err != nil {
+			return err
+		}
+		buckets, err = c.ListBuckets(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
+	if bucketSort == "name" {
+		sort.Strings(buckets)
 	}
+	if bucketTop > 0 && bucketTop < len(buckets) {
+		buckets = buckets[:bucketTop]
+	}
+	return printResource(bucketList(buckets))
+}
 
-	for _, j := range buckets {
-		fmt.Println(j)
+// listBucketStats returns stats of all buckets, or of the buckets owned by
+// uid when it is set.
+func listBucketStats(uid string) (bucketStatsList, error) {
+	args := url.Values{"stats": {"true"}}
+	if uid != "" {
+		args.Set("uid", uid)
+	}
+	body, err := adminCall(context.Background(), http.MethodGet, "/bucket", args)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	buckets := bucketStatsList{}
+	err = json.Unmarshal(body, &buckets)
+	return buckets, err
+}
+
+// sortBuckets sorts by name ascending, or by size, objects and creation time
+// descending so the biggest and newest buckets come first.
+func sortBuckets(buckets bucketStatsList, key string) {
+	sort.SliceStable(buckets, func(i, j int) bool {
+		a, b := buckets[i], buckets[j]
+		switch key {
+		case "size":
+			sa, _, _ := a.totals()
+			sb, _, _ := b.totals()
+			return sa > sb
+		case "objects":
+			_, _, oa := a.totals()
+			_, _, ob := b.totals()
+			return oa > ob
+		case "created":
+			return a.CreationTime > b.CreationTime
+		case "name":
+			return a.Bucket < b.Bucket
+		}
+		return false
+	})
 }
 
 func getBucketInfo(bucket Bucket) error {
-	fmt.Println("inside function")
-	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	b, err := getBucket(bucket.Bucket)
 	if err != nil {
 		return err
 	}
+	return printResource(b)
+}
 
-	fmt.Println("after connection")
-	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{ID: bucket.ID})
+// getBucket returns bucket stats. go-ceph's GetBucketInfo drops the creation
+// time, versioning and all usage categories except rgw.main and rgw.multimeta,
+// so the stats are decoded from the admin API response directly.
+func getBucket(bucket string) (Bucket, error) {
+	var b Bucket
+	args := url.Values{"bucket": {bucket}, "stats": {"true"}}
+	body, err := adminCall(context.Background(), http.MethodGet, "/bucket", args)
 	if err != nil {
-		return err
+		return b, err
+	}
+	err = json.Unmarshal(body, &b)
+	return b, err
+}
+
+type bucketList []string
+
+func (l bucketList) table() table {
+	t := table{headers: []string{"Bucket"}}
+	for _, name := range l {
+		t.rows = append(t.rows, []string{name})
 	}
-	fmt.Println("after getbucketinfo")
-	w := tabwriter.NewWriter(os.Stdout, 10, 1, 5, ' ', 0)
+	return t
+}
+
+func (l bucketList) names() []string {
+	return l
+}
+
+type bucketStatsList []Bucket
+
+func (l bucketStatsList) table() table {
+	t := table{
+		headers: []string{"Bucket", "Owner", "Size", "Objects", "Shards", "Created", "Zonegroup", "Placement Rule"},
+		wide:    2,
+	}
+	for _, b := range l {
+		size, _, objects := b.totals()
+		t.rows = append(t.rows, []string{
+			b.Bucket, b.Owner, formatSize(size), strconv.FormatUint(objects, 10),
+			formatCount(b.NumShards), b.CreationTime, b.Zonegroup, b.PlacementRule,
+		})
+	}
+	return t
+}
+
+func (l bucketStatsList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, b := range l {
+		names = append(names, b.Bucket)
+	}
+	return names
+}
+
+func (b Bucket) table() table {
+	t := table{headers: []string{"Field", "Value"}}
+	add := func(field, value string) {
+		if value == "" {
+			value = "-"
+		}
+		t.rows = append(t.rows, []string{field, value})
+	}
+
+	actual, utilized, objects := b.totals()
+	add("Bucket", b.Bucket)
+	add("ID", b.ID)
+	add("Marker", b.Marker)
+	add("Owner", b.Owner)
+	add("Zonegroup", b.Zonegroup)
+	add("Placement Rule", b.PlacementRule)
+	add("Index Type", b.IndexType)
+	add("Shards", formatCount(b.NumShards))
+	add("Created", b.CreationTime)
+	add("Modified", b.Mtime)
+	add("Versioning", b.Versioning)
+	add("Size Actual", formatSize(actual))
+	add("Size Utilized", formatSize(utilized))
+	add("Objects", strconv.FormatUint(objects, 10))
+	for _, category := range b.categories() {
+		add("Objects "+category, formatCount(b.Usage[category].NumObjects))
+	}
+	add("Quota Enabled", formatEnabled(b.BucketQuota.Enabled))
+	add("Quota Size", formatUsage(&actual, b.BucketQuota.MaxSize, true))
+	add("Quota Objects", formatUsage(&objects, b.BucketQuota.MaxObjects, false))
+	return t
+}
+
+// totals returns the actual and utilized size and the object count summed
+// over all usage categories.
+func (b Bucket) totals() (actual, utilized, objects uint64) {
+	for _, u := range b.Usage {
+		if u.SizeActual != nil {
+			actual += *u.SizeActual
+		}
+		if u.SizeUtilized != nil {
+			utilized += *u.SizeUtilized
+		}
+		if u.NumObjects != nil {
+			objects += *u.NumObjects
+		}
+	}
+	return actual, utilized, objects
+}
+
+// categories returns the sorted usage categories of the bucket.
+func (b Bucket) categories() []string {
+	categories := make([]string, 0, len(b.Usage))
+	for category := range b.Usage {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
 
-	fs := "%s\t%s\t%s\n"
-	fmt.Fprintln(w, "ID\tBucket\tOwner")
-	fmt.Fprintf(w, fs, b.ID, b.Bucket, b.Owner)
-	w.Flush()
+func formatCount(n *uint64) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.FormatUint(*n, 10)
+}
 
-	return nil
+func (b Bucket) names() []string {
+	return []string{b.Bucket}
 }
@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// deleteBucketCmd represents the bucket delete command
+var (
+	deleteBucketCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Delete bucket",
+		Long: `Delete bucket.
+
+Buckets with objects are deleted only with --purge-objects, which removes
+all objects of the bucket. The bucket name must be typed to confirm the
+deletion, unless --yes is given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if bucketName == "" {
+				fmt.Printf("error: %s\n", errMissingBucketID)
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := deleteBucket(bucketName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	bucketCmd.AddCommand(deleteBucketCmd)
+
+	deleteBucketCmd.Flags().StringVarP(&bucketName, "bucket", "b", "", "Bucket name")
+	deleteBucketCmd.Flags().BoolVar(&bucketPurgeObjects, "purge-objects", false, "Remove all objects of the bucket")
+	deleteBucketCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Delete without confirmation")
+	deleteBucketCmd.MarkFlagRequired("bucket")
+}
+
+func deleteBucket(bucket string) error {
+	// purging a large bucket takes longer than the default client timeout
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, &http.Client{})
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+	if err != nil {
+		return err
+	}
+
+	var objects, size uint64
+	for _, u := range []*uint64{b.Usage.RgwMain.NumObjects, b.Usage.RgwMultimeta.NumObjects} {
+		if u != nil {
+			objects += *u
+		}
+	}
+	if b.Usage.RgwMain.SizeActual != nil {
+		size = *b.Usage.RgwMain.SizeActual
+	}
+
+	fmt.Fprintf(os.Stderr, "Bucket:  %s\nOwner:   %s\nObjects: %d\nSize:    %s\n", b.Bucket, b.Owner, objects, formatSize(size))
+
+	if objects > 0 && !bucketPurgeObjects {
+		return fmt.Errorf("%w: %s has %d objects, use --purge-objects to remove them", errBucketNotEmpty, bucket, objects)
+	}
+
+	if !assumeYes {
+		if objects > 0 {
+			fmt.Fprintf(os.Stderr, "All %d objects (%s) will be removed.\n", objects, formatSize(size))
+		}
+		if ReadKey("Type the bucket name to confirm:") != bucket {
+			return errNotConfirmed
+		}
+	}
+
+	purge := bucketPurgeObjects
+	err = c.RemoveBucket(context.Background(), admin.Bucket{Bucket: bucket, PurgeObject: &purge})
+	if err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Printf("Deleted bucket %s\n", bucket)
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxCopyObjectSize is the largest object copied with a single request
+	maxCopyObjectSize = 5 << 30
+	copyPartSize      = 1 << 30
+)
+
+// linkBucketCmd represents the bucket link command
+var (
+	linkBucketCmd = &cobra.Command{
+		Use:   "link",
+		Short: "Link bucket to user",
+		Long: `Link bucket to user, unlinking it from the current owner:
+
+cephmgr rgw bucket link --bucket logs --user alice`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if bucketName == "" || userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := linkBucket(bucketName, userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	unlinkBucketCmd = &cobra.Command{
+		Use:   "unlink",
+		Short: "Unlink bucket from user",
+		Long: `Unlink bucket from user, the bucket owner when --user is not given.
+The bucket and its objects are kept.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if bucketName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := unlinkBucket(bucketName, userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	chownBucketCmd = &cobra.Command{
+		Use:   "chown",
+		Short: "Change bucket and object owner",
+		Long: `Link bucket to user and make the user owner of all objects in the bucket.
+
+The objects are rewritten through the S3 endpoint with the keys of both users:
+the previous owner grants the new owner access to each object, then the new
+owner copies the object onto itself, which makes it the object owner.
+Metadata, tags, object ACL grants and SSE-S3 or SSE-KMS encryption are kept,
+grants of the previous owner go to the new owner. Objects over 5 GiB are
+copied in parts. Objects encrypted with customer keys (SSE-C) can not be
+copied and stop the command. Both users need an S3 key.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if bucketName == "" || userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := chownBucket(bucketName, userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	bucketCmd.AddCommand(linkBucketCmd)
+	bucketCmd.AddCommand(unlinkBucketCmd)
+	bucketCmd.AddCommand(chownBucketCmd)
+
+	for _, c := range []*cobra.Command{linkBucketCmd, unlinkBucketCmd, chownBucketCmd} {
+		c.Flags().StringVarP(&bucketName, "bucket", "b", "", "Bucket name")
+		c.Flags().StringVarP(&userName, "user", "u", "", "User ID")
+		c.MarkFlagRequired("bucket")
+	}
+	linkBucketCmd.MarkFlagRequired("user")
+	chownBucketCmd.MarkFlagRequired("user")
+}
+
+func linkBucket(bucket, uid string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+	if err != nil {
+		return err
+	}
+
+	err = c.LinkBucket(context.Background(), admin.BucketLinkInput{Bucket: b.Bucket, BucketID: b.ID, UID: uid})
+	if err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Printf("Linked bucket %s to %s (was %s)\n", bucket, uid, b.Owner)
+		return nil
+	}
+	return printBucket(c, bucket)
+}
+
+func unlinkBucket(bucket, uid string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	if uid == "" {
+		b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+		if err != nil {
+			return err
+		}
+		uid = b.Owner
+	}
+
+	err = c.UnlinkBucket(context.Background(), admin.BucketLinkInput{Bucket: bucket, UID: uid})
+	if err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Printf("Unlinked bucket %s from %s\n", bucket, uid)
+		return nil
+	}
+	return printBucket(c, bucket)
+}
+
+func chownBucket(bucket, uid string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+	if err != nil {
+		return err
+	}
+	oldOwner, err := userS3Client(c, b.Owner)
+	if err != nil {
+		return err
+	}
+	newOwner, err := userS3Client(c, uid)
+	if err != nil {
+		return err
+	}
+
+	err = c.LinkBucket(context.Background(), admin.BucketLinkInput{Bucket: b.Bucket, BucketID: b.ID, UID: uid})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Linked bucket %s to %s (was %s)\n", bucket, uid, b.Owner)
+
+	count := 0
+	var copyErr error
+	err = newOwner.ListObjectsV2PagesWithContext(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(bucket)},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				if err := chownObject(oldOwner, newOwner, bucket, b.Owner, uid, *obj.Key); err != nil {
+					copyErr = fmt.Errorf("%s: %w", *obj.Key, err)
+					return false
+				}
+				count++
+				if count%1000 == 0 {
+					fmt.Fprintf(os.Stderr, "%d objects rewritten\n", count)
+				}
+			}
+			return true
+		})
+	if err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		return fmt.Errorf("bucket linked, %d objects rewritten before error: %w", count, err)
+	}
+
+	if humanOutput() {
+		fmt.Printf("Bucket %s and %d objects now owned by %s\n", bucket, count, uid)
+		return nil
+	}
+	return printBucket(c, bucket)
+}
+
+// chownObject gives the new owner access to the object and copies the object
+// onto itself as the new owner. Objects larger than a single copy allows are
+// copied in parts.
+func chownObject(oldOwner, newOwner *s3.S3, bucket, oldUID, newUID, key string) error {
+	acl, err := oldOwner.GetObjectAclWithContext(context.Background(), &s3.GetObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = oldOwner.PutObjectAclWithContext(context.Background(), &s3.PutObjectAclInput{
+		Bucket:           aws.String(bucket),
+		Key:              aws.String(key),
+		GrantFullControl: aws.String(fmt.Sprintf("id=%s,id=%s", oldUID, newUID)),
+	})
+	if err != nil {
+		return err
+	}
+
+	head, err := newOwner.HeadObjectWithContext(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	if head.SSECustomerAlgorithm != nil {
+		// the copy would need the customer key, which only the client has
+		return errSSECustomerKey
+	}
+	if aws.Int64Value(head.ContentLength) > maxCopyObjectSize {
+		err = copyObjectParts(newOwner, bucket, key, head)
+	} else {
+		// copying an object onto itself needs a metadata change, so the
+		// metadata is replaced with its current values
+		_, err = newOwner.CopyObjectWithContext(context.Background(), &s3.CopyObjectInput{
+			Bucket:               aws.String(bucket),
+			Key:                  aws.String(key),
+			CopySource:           aws.String(copySource(bucket, key)),
+			MetadataDirective:    aws.String(s3.MetadataDirectiveReplace),
+			TaggingDirective:     aws.String(s3.TaggingDirectiveCopy),
+			Metadata:             storedMetadata(head.Metadata),
+			ContentType:          head.ContentType,
+			ContentEncoding:      head.ContentEncoding,
+			ContentDisposition:   head.ContentDisposition,
+			ContentLanguage:      head.ContentLanguage,
+			CacheControl:         head.CacheControl,
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+			StorageClass:         head.StorageClass,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// the copy has the default ACL of the new owner
+	grants := ownerGrants(acl.Grants, oldUID, newUID)
+	if grants == nil {
+		return nil
+	}
+	_, err = newOwner.PutObjectAclWithContext(context.Background(), &s3.PutObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		AccessControlPolicy: &s3.AccessControlPolicy{
+			Owner:  &s3.Owner{ID: aws.String(newUID)},
+			Grants: grants,
+		},
+	})
+	return err
+}
+
+// ownerGrants returns the grants of an object ACL with the grants of the old
+// owner given to the new owner, or nil when the ACL is the default one, full
+// control for the owner only.
+func ownerGrants(grants []*s3.Grant, oldUID, newUID string) []*s3.Grant {
+	moved := make([]*s3.Grant, 0, len(grants))
+	custom := false
+	for _, g := range grants {
+		grantee := g.Grantee
+		if grantee != nil && aws.StringValue(grantee.ID) == oldUID {
+			copied := *grantee
+			copied.ID = aws.String(newUID)
+			copied.DisplayName = nil
+			grantee = &copied
+			if aws.StringValue(g.Permission) != s3.PermissionFullControl {
+				custom = true
+			}
+		} else {
+			custom = true
+		}
+		moved = append(moved, &s3.Grant{Grantee: grantee, Permission: g.Permission})
+	}
+	if !custom {
+		return nil
+	}
+	return moved
+}
+
+// storedMetadata returns the user metadata with the keys as RGW stores them.
+// RGW keeps metadata keys in lower case, while the SDK returns them in
+// canonical header form like Foo-Bar.
+func storedMetadata(metadata map[string]*string) map[string]*string {
+	stored := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		stored[strings.ToLower(k)] = v
+	}
+	return stored
+}
+
+// copyObjectParts copies an object onto itself with a multipart upload, with
+// the metadata, tags and encryption of head.
+func copyObjectParts(client *s3.S3, bucket, key string, head *s3.HeadObjectOutput) error {
+	ctx := context.Background()
+	tagging, err := client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	tags := url.Values{}
+	for _, t := range tagging.TagSet {
+		tags.Set(aws.StringValue(t.Key), aws.StringValue(t.Value))
+	}
+
+	upload, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Metadata:             storedMetadata(head.Metadata),
+		ContentType:          head.ContentType,
+		ContentEncoding:      head.ContentEncoding,
+		ContentDisposition:   head.ContentDisposition,
+		ContentLanguage:      head.ContentLanguage,
+		CacheControl:         head.CacheControl,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+		StorageClass:         head.StorageClass,
+		Tagging:              aws.String(tags.Encode()),
+	})
+	if err != nil {
+		return err
+	}
+
+	size := aws.Int64Value(head.ContentLength)
+	var parts []*s3.CompletedPart
+	for start := int64(0); start < size; start += copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part, err := client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			UploadId:          upload.UploadId,
+			PartNumber:        aws.Int64(int64(len(parts) + 1)),
+			CopySource:        aws.String(copySource(bucket, key)),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			CopySourceIfMatch: head.ETag,
+		})
+		if err != nil {
+			client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      aws.String(key),
+				UploadId: upload.UploadId,
+			})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(int64(len(parts) + 1))})
+	}
+
+	_, err = client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+// userS3Client returns an S3 client using the first S3 key of the user. Keys
+// of tenant users are listed as tenant$uid, so the first key of the user or
+// its subusers is used when none matches uid.
+func userS3Client(c *admin.API, uid string) (*s3.S3, error) {
+	u, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNoUserKey, uid)
+	}
+	for _, k := range u.Keys {
+		if k.User == uid {
+			return newS3Client(cephHost, k.AccessKey, k.SecretKey)
+		}
+	}
+	k := u.Keys[0]
+	return newS3Client(cephHost, k.AccessKey, k.SecretKey)
+}
+
+func printBucket(c *admin.API, bucket string) error {
+	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+	if err != nil {
+		return err
+	}
+
+	var bucketdata Bucket
+	if err := remarshal(b, &bucketdata); err != nil {
+		return err
+	}
+	return printResource(bucketdata)
+}
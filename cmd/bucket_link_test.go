@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestOwnerGrants(t *testing.T) {
+	user := func(id, perm string) *s3.Grant {
+		return &s3.Grant{
+			Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String(id)},
+			Permission: aws.String(perm),
+		}
+	}
+	allUsers := &s3.Grant{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+		Permission: aws.String(s3.PermissionRead),
+	}
+
+	tests := []struct {
+		name   string
+		grants []*s3.Grant
+		want   []*s3.Grant
+	}{
+		{"default", []*s3.Grant{user("alice", s3.PermissionFullControl)}, nil},
+		{"none", nil, nil},
+		{
+			"public read",
+			[]*s3.Grant{user("alice", s3.PermissionFullControl), allUsers},
+			[]*s3.Grant{user("bob", s3.PermissionFullControl), allUsers},
+		},
+		{
+			"other user",
+			[]*s3.Grant{user("alice", s3.PermissionFullControl), user("carol", s3.PermissionRead)},
+			[]*s3.Grant{user("bob", s3.PermissionFullControl), user("carol", s3.PermissionRead)},
+		},
+		{
+			"owner read only",
+			[]*s3.Grant{user("alice", s3.PermissionRead)},
+			[]*s3.Grant{user("bob", s3.PermissionRead)},
+		},
+	}
+	for _, tt := range tests {
+		if got := ownerGrants(tt.grants, "alice", "bob"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ownerGrants() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoredMetadata(t *testing.T) {
+	got := storedMetadata(map[string]*string{"Foo-Bar": aws.String("1"), "baz": aws.String("2")})
+	want := map[string]*string{"foo-bar": aws.String("1"), "baz": aws.String("2")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("storedMetadata() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// bucketQuotaCmd represents the bucket quota command
+var (
+	bucketQuotaCmd = &cobra.Command{
+		Use:   "quota",
+		Short: "Bucket quota operations",
+		Long: `Get and set the quota of a bucket with --bucket, or the default
+bucket quota of a user with --user. The user default applies to every
+bucket of the user which has no quota of its own.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	getBucketQuotaCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Get bucket quota",
+		Long:  `Get bucket quota with current usage, or user default bucket quota`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if (bucketName == "") == (userName == "") {
+				fmt.Printf("error: %s\n", errBucketOrUser)
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := getBucketQuota(bucketName, userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	setBucketQuotaCmd = &cobra.Command{
+		Use:   "set",
+		Short: "Set bucket quota",
+		Long: `Set bucket quota limits. Sizes accept units like 500G or 1.5T,
+-1 removes the limit. --enable on its own enables the current limits:
+
+cephmgr rgw bucket quota set --bucket logs --max-size 100G --enable
+cephmgr rgw bucket quota set --user alice --max-objects 1000000 --enable
+cephmgr rgw bucket quota set --bucket logs --enable=false`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if (bucketName == "") == (userName == "") {
+				fmt.Printf("error: %s\n", errBucketOrUser)
+				cmd.Help()
+				os.Exit(1)
+			}
+			quota, err := quotaFromFlags(cmd)
+			if err == nil {
+				err = setBucketQuota(bucketName, userName, quota)
+			}
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	clearBucketQuotaCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Clear bucket quota",
+		Long:  `Disable bucket quota and remove its limits`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if (bucketName == "") == (userName == "") {
+				fmt.Printf("error: %s\n", errBucketOrUser)
+				cmd.Help()
+				os.Exit(1)
+			}
+			enabled := false
+			unlimited := int64(-1)
+			quota := admin.QuotaSpec{Enabled: &enabled, MaxSize: &unlimited, MaxObjects: &unlimited}
+			err := setBucketQuota(bucketName, userName, quota)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	bucketCmd.AddCommand(bucketQuotaCmd)
+	bucketQuotaCmd.AddCommand(getBucketQuotaCmd)
+	bucketQuotaCmd.AddCommand(setBucketQuotaCmd)
+	bucketQuotaCmd.AddCommand(clearBucketQuotaCmd)
+
+	bucketQuotaCmd.PersistentFlags().StringVarP(&bucketName, "bucket", "b", "", "Bucket name")
+	bucketQuotaCmd.PersistentFlags().StringVarP(&userName, "user", "u", "", "User ID for user default bucket quota")
+
+	setBucketQuotaCmd.Flags().StringVar(&quotaMaxSize, "max-size", "", "Maximum size, e.g. 500G, -1 for unlimited")
+	setBucketQuotaCmd.Flags().Int64Var(&quotaMaxObjects, "max-objects", 0, "Maximum number of objects, -1 for unlimited")
+	setBucketQuotaCmd.Flags().BoolVar(&quotaEnable, "enable", false, "Enable quota")
+}
+
+func getBucketQuota(bucket, uid string) error {
+	if uid != "" {
+		// go-ceph GetUserQuota always asks for the user quota type
+		args := url.Values{}
+		args.Set("uid", uid)
+		args.Set("quota-type", "bucket")
+		body, err := adminCall(context.Background(), http.MethodGet, "/user?quota", args)
+		if err != nil {
+			return err
+		}
+		info := bucketQuotaInfo{Owner: uid}
+		if err := json.Unmarshal(body, &info.Quota); err != nil {
+			return err
+		}
+		return printResource(info)
+	}
+
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+	if err != nil {
+		return err
+	}
+
+	info := bucketQuotaInfo{
+		Bucket:     b.Bucket,
+		Owner:      b.Owner,
+		Size:       b.Usage.RgwMain.Size,
+		NumObjects: b.Usage.RgwMain.NumObjects,
+	}
+	if err := remarshal(b.BucketQuota, &info.Quota); err != nil {
+		return err
+	}
+	return printResource(info)
+}
+
+func setBucketQuota(bucket, uid string, quota admin.QuotaSpec) error {
+	if err := putBucketQuota(bucket, uid, quota); err != nil {
+		return err
+	}
+	return getBucketQuota(bucket, uid)
+}
+
+// putBucketQuota sets the quota of a bucket, or the default bucket quota of
+// the user when uid is set.
+func putBucketQuota(bucket, uid string, quota admin.QuotaSpec) error {
+	args := url.Values{}
+	path := "/user?quota"
+	if uid != "" {
+		args.Set("uid", uid)
+		args.Set("quota-type", "bucket")
+	} else {
+		// the bucket quota API needs the owner of the bucket
+		c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+		if err != nil {
+			return err
+		}
+		b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+		if err != nil {
+			return err
+		}
+		path = "/bucket?quota"
+		args.Set("uid", b.Owner)
+		args.Set("bucket", bucket)
+	}
+
+	if quota.Enabled != nil {
+		args.Set("enabled", strconv.FormatBool(*quota.Enabled))
+	}
+	if quota.MaxSize != nil {
+		args.Set("max-size", strconv.FormatInt(*quota.MaxSize, 10))
+	}
+	if quota.MaxObjects != nil {
+		args.Set("max-objects", strconv.FormatInt(*quota.MaxObjects, 10))
+	}
+
+	// go-ceph SetIndividualBucketQuota is only in ceph_preview builds and
+	// SetUserQuota cannot set the bucket quota type
+	_, err := adminCall(context.Background(), http.MethodPut, path, args)
+	return err
+}
+
+// bucketQuotaInfo is the quota of a bucket with its usage, or the default
+// bucket quota of a user when Bucket is empty.
+type bucketQuotaInfo struct {
+	Bucket     string    `json:"bucket,omitempty"`
+	Owner      string    `json:"owner"`
+	Quota      QuotaSpec `json:"bucket_quota"`
+	Size       *uint64   `json:"size,omitempty"`
+	NumObjects *uint64   `json:"num_objects,omitempty"`
+}
+
+func (q bucketQuotaInfo) table() table {
+	return table{
+		headers: []string{"Bucket", "Owner", "Enabled", "Size", "Objects"},
+		rows: [][]string{{
+			q.Bucket, q.Owner, formatEnabled(q.Quota.Enabled),
+			formatUsage(q.Size, q.Quota.MaxSize, true),
+			formatUsage(q.NumObjects, q.Quota.MaxObjects, false),
+		}},
+	}
+}
+
+func (q bucketQuotaInfo) names() []string {
+	if q.Bucket == "" {
+		return []string{q.Owner}
+	}
+	return []string{q.Bucket}
+}
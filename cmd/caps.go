@@ -124,9 +124,11 @@ func addUserCaps(user User) error {
 		return err
 	}
 
-	fmt.Printf("User ID: %s\n", user.ID)
-	fmt.Println(userCaps)
-	return nil
+	caps := capsInfo{ID: user.ID}
+	if err := remarshal(userCaps, &caps.Caps); err != nil {
+		return err
+	}
+	return printResource(caps)
 }
 
 func removeUserCaps(user User) error {
@@ -141,7 +143,31 @@ func removeUserCaps(user User) error {
 		return err
 	}
 
-	fmt.Printf("User ID: %s\n", user.ID)
-	fmt.Println(userCaps)
-	return nil
+	caps := capsInfo{ID: user.ID}
+	if err := remarshal(userCaps, &caps.Caps); err != nil {
+		return err
+	}
+	return printResource(caps)
+}
+
+// capsInfo is the capabilities of a user after a change.
+type capsInfo struct {
+	ID   string        `json:"user_id"`
+	Caps []UserCapSpec `json:"caps"`
+}
+
+func (c capsInfo) table() table {
+	t := table{headers: []string{"UID", "Type", "Perm"}}
+	for _, cap := range c.Caps {
+		t.rows = append(t.rows, []string{c.ID, cap.Type, cap.Perm})
+	}
+	return t
+}
+
+func (c capsInfo) names() []string {
+	var names []string
+	for _, cap := range c.Caps {
+		names = append(names, cap.Type+"="+cap.Perm)
+	}
+	return names
 }
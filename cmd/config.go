@@ -0,0 +1,463 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configCmd represents the config command
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage cephmgr config file",
+		Long: `Manage the clusters kept in cephmgr config file.
+
+The config file is $HOME/.cephmgr.yaml unless --config is given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	viewConfigCmd = &cobra.Command{
+		Use:   "view",
+		Short: "Show config file",
+		Long: `Show config file content as YAML, or JSON with -o json.
+
+Access secrets are redacted unless --raw is given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := viewConfig()
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	setClusterCmd = &cobra.Command{
+		Use:   "set-cluster NAME",
+		Short: "Add or change a cluster",
+		Long: `Add a cluster to config file or change an existing one.
+
+Only the given flags are changed on an existing cluster:
+
+cephmgr config set-cluster prod --hostname https://rgw.example.com --access-key KEY --access-secret SECRET`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cluster := &Cluster{
+				Hostname:     clusterHostname,
+				AccessKey:    clusterAccessKey,
+				AccessSecret: clusterAccessSecret,
+			}
+			err := setCluster(args[0], *cluster)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	useClusterCmd = &cobra.Command{
+		Use:   "use-cluster NAME",
+		Short: "Set current cluster",
+		Long:  `Set the cluster used when --cluster is not given`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := useCluster(args[0])
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	deleteClusterCmd = &cobra.Command{
+		Use:   "delete-cluster NAME",
+		Short: "Delete a cluster",
+		Long:  `Delete a cluster from config file`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := deleteCluster(args[0])
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	getClustersCmd = &cobra.Command{
+		Use:   "get-clusters",
+		Short: "List clusters",
+		Long:  `List clusters in config file`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := getClusters()
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	testClusterCmd = &cobra.Command{
+		Use:   "test [NAME]",
+		Short: "Test cluster connection",
+		Long: `Test cluster connection and credentials.
+
+Looks up the user owning the access key with an admin API call.
+Without NAME the cluster selected with --cluster or current-cluster is tested.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := viper.GetString("cluster")
+			if len(args) > 0 {
+				name = args[0]
+			}
+			err := testCluster(name)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+
+	configCmd.AddCommand(viewConfigCmd)
+	configCmd.AddCommand(setClusterCmd)
+	configCmd.AddCommand(useClusterCmd)
+	configCmd.AddCommand(deleteClusterCmd)
+	configCmd.AddCommand(getClustersCmd)
+	configCmd.AddCommand(testClusterCmd)
+
+	viewConfigCmd.Flags().BoolVar(&configRaw, "raw", false, "Show access secrets")
+
+	setClusterCmd.Flags().StringVar(&clusterHostname, "hostname", "", "Ceph S3 host with scheme")
+	setClusterCmd.Flags().StringVar(&clusterAccessKey, "access-key", "", "Ceph access key")
+	setClusterCmd.Flags().StringVar(&clusterAccessSecret, "access-secret", "", "Ceph access secret")
+}
+
+// readConfig reads the config file without viper, which would lower-case
+// the cluster names.
+func readConfig() (string, Config, error) {
+	var config Config
+	path, err := configFilePath()
+	if err != nil {
+		return "", config, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return path, config, nil
+	}
+	if err != nil {
+		return "", config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return "", config, fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	// move a config file without cluster profiles to the default cluster
+	if len(config.Clusters) == 0 && config.Hostname != "" {
+		config.Clusters = map[string]Cluster{
+			defaultClusterName: {
+				Hostname:     config.Hostname,
+				AccessKey:    config.AccessKey,
+				AccessSecret: config.AccessSecret,
+			},
+		}
+		if config.CurrentCluster == "" {
+			config.CurrentCluster = defaultClusterName
+		}
+		config.Hostname, config.AccessKey, config.AccessSecret = "", "", ""
+	}
+	return path, config, nil
+}
+
+// writeConfig replaces the config file with a temporary file written next to
+// it, so an interrupted write never leaves a truncated config behind. Only
+// the clusters and current-cluster keys are changed, other keys and comments
+// of the file are kept.
+func writeConfig(path string, config Config) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("cannot parse config file %s: not a mapping", path)
+	}
+
+	if err := setConfigKey(root, "current-cluster", config.CurrentCluster); err != nil {
+		return err
+	}
+	if err := setConfigKey(root, "clusters", config.Clusters); err != nil {
+		return err
+	}
+	if config.Hostname == "" {
+		// the single cluster was moved to the clusters by readConfig
+		for _, key := range []string{"hostname", "accessKey", "accessSecret"} {
+			deleteConfigKey(root, key)
+		}
+	}
+
+	data, err = yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".cephmgr-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// setConfigKey sets key of the mapping node to value, appending the key when
+// it is missing.
+func setConfigKey(mapping *yaml.Node, key string, value interface{}) error {
+	var v yaml.Node
+	if err := v.Encode(value); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = &v
+			return nil
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &v)
+	return nil
+}
+
+func deleteConfigKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func viewConfig() error {
+	_, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	if !configRaw {
+		for name, cluster := range config.Clusters {
+			if cluster.AccessSecret != "" {
+				cluster.AccessSecret = redactedValue
+			}
+			config.Clusters[name] = cluster
+		}
+	}
+
+	if outputFormat == outputJSON {
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+func setCluster(name string, cluster Cluster) error {
+	path, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if config.Clusters == nil {
+		config.Clusters = map[string]Cluster{}
+	}
+
+	current, ok := config.Clusters[name]
+	if cluster.Hostname != "" {
+		current.Hostname = cluster.Hostname
+	}
+	if cluster.AccessKey != "" {
+		current.AccessKey = cluster.AccessKey
+	}
+	if cluster.AccessSecret != "" {
+		current.AccessSecret = cluster.AccessSecret
+	}
+	config.Clusters[name] = current
+	if config.CurrentCluster == "" {
+		config.CurrentCluster = name
+	}
+
+	if err := writeConfig(path, config); err != nil {
+		return err
+	}
+	if ok {
+		fmt.Printf("Cluster %s changed\n", name)
+	} else {
+		fmt.Printf("Cluster %s added\n", name)
+	}
+	return nil
+}
+
+func useCluster(name string) error {
+	path, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Clusters[name]; !ok {
+		return fmt.Errorf("%w: %s", errClusterNotFound, name)
+	}
+
+	config.CurrentCluster = name
+	if err := writeConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to cluster %s\n", name)
+	return nil
+}
+
+func deleteCluster(name string) error {
+	path, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Clusters[name]; !ok {
+		return fmt.Errorf("%w: %s", errClusterNotFound, name)
+	}
+
+	delete(config.Clusters, name)
+	if config.CurrentCluster == name {
+		config.CurrentCluster = ""
+		fmt.Fprintf(os.Stderr, "warning: deleted the current cluster, select a new one with \"cephmgr config use-cluster\"\n")
+	}
+	if err := writeConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Printf("Cluster %s deleted\n", name)
+	return nil
+}
+
+func getClusters() error {
+	_, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	l := clusterList{}
+	for name, cluster := range config.Clusters {
+		l = append(l, clusterInfo{
+			Name:     name,
+			Hostname: cluster.Hostname,
+			Current:  name == config.CurrentCluster,
+		})
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return printResource(l)
+}
+
+type clusterInfo struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	Current  bool   `json:"current"`
+}
+
+type clusterList []clusterInfo
+
+func (l clusterList) table() table {
+	t := table{headers: []string{"Current", "Name", "Hostname"}}
+	for _, c := range l {
+		current := ""
+		if c.Current {
+			current = "*"
+		}
+		t.rows = append(t.rows, []string{current, c.Name, c.Hostname})
+	}
+	return t
+}
+
+func (l clusterList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, c := range l {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func testCluster(name string) error {
+	_, config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	cluster, err := config.cluster(name)
+	if err != nil {
+		return err
+	}
+
+	c, err := admin.New(cluster.Hostname, cluster.AccessKey, cluster.AccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	u, err := c.GetUser(context.Background(), admin.User{Keys: []admin.UserKeySpec{{AccessKey: cluster.AccessKey}}})
+	if err != nil {
+		return fmt.Errorf("cluster %s: %w", cluster.Hostname, err)
+	}
+
+	fmt.Printf("Connected to %s as %s\n", cluster.Hostname, u.ID)
+	return nil
+}
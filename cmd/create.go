@@ -23,8 +23,8 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/ceph/go-ceph/rgw/admin"
 	"github.com/spf13/cobra"
@@ -38,8 +38,36 @@ var (
 		Long: `Create new user.
 You can also provide capabilities for user with --caps flag:
 
---caps "buckets=*"`,
+--caps "buckets=*"
+
+Secret keys are not shown unless --show-secrets is given. Save the new
+credentials to a file with --secret-output-file and --secret-format:
+
+--secret-output-file creds.env --secret-format env|aws-credentials|s3cfg|rclone
+
+Create many users from a CSV or YAML file with --from-file. CSV files start
+with a header row naming the columns uid, display name, email, caps and quota,
+quota being SIZE, SIZE/OBJECTS or /OBJECTS:
+
+uid,display name,email,caps,quota
+alice,Alice,alice@example.com,buckets=*;users=read,500G/100000
+
+YAML files hold a list with the keys uid, displayName, email, caps and quota.
+Users are created by --workers in parallel and failed rows do not stop the
+others. Keys and the status of each row are written to --result-file.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if usersFile != "" {
+				err := createUsersFromFile(usersFile)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				return
+			}
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
 
 			user := &User{
 				ID:          userName,
@@ -63,34 +91,64 @@ func init() {
 
 	createCmd.Flags().StringVarP(&userFullname, "fullname", "f", "", "Ceph user name")
 	createCmd.Flags().StringVarP(&userEmail, "email", "e", "", "Ceph user name")
-
-	createCmd.MarkFlagRequired("user")
+	createCmd.Flags().StringVar(&secretOutputFile, "secret-output-file", "", "Write credentials to file (created with 0600 permissions)")
+	createCmd.Flags().StringVar(&secretFormat, "secret-format", "", "Credentials format: env|aws-credentials|s3cfg|rclone (default env)")
 
 }
 
 func createUser(user User) error {
+	secrets, err := openSecretOutput()
+	if err != nil {
+		return err
+	}
+	defer secrets.discard()
 
 	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
 	if err != nil {
 		return err
 	}
-	users, err := c.CreateUser(context.Background(), admin.User{ID: user.ID, DisplayName: user.DisplayName, UserCaps: user.UserCaps})
+	users, err := c.CreateUser(context.Background(), admin.User{
+		ID:          user.ID,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		UserCaps:    user.UserCaps,
+		MaxBuckets:  user.MaxBuckets,
+		Suspended:   user.Suspended,
+	})
 
 	if err != nil {
 		return err
 	}
 
-	buser, _ := json.Marshal(users)
-
 	var userdata User
-	_ = json.Unmarshal([]byte(buser), &userdata)
+	if err := remarshal(users, &userdata); err != nil {
+		return err
+	}
 
-	fmt.Printf("Created user for %s\n", userdata.DisplayName)
+	if secrets != nil && len(userdata.Keys) > 0 {
+		if secrets.save(userdata.ID, userdata.Keys[0]) {
+			return nil
+		}
+	}
+	maskUserSecrets(&userdata)
 
-	for _, ad := range userdata.Keys {
-		fmt.Println("ID:", ad.User)
-		fmt.Println("accesskey:", ad.AccessKey)
-		fmt.Println("secret:", ad.SecretKey)
+	if humanOutput() {
+		fmt.Printf("Created user for %s\n", userdata.DisplayName)
 	}
-	return nil
+	return printResource(createdUser(userdata))
+}
+
+// createdUser shows the keys of a new user in table output.
+type createdUser User
+
+func (u createdUser) table() table {
+	t := table{headers: []string{"ID", "Access Key", "Secret"}}
+	for _, k := range u.Keys {
+		t.rows = append(t.rows, []string{k.User, k.AccessKey, k.SecretKey})
+	}
+	return t
+}
+
+func (u createdUser) names() []string {
+	return []string{u.ID}
 }
@@ -0,0 +1,333 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	createCmd.Flags().StringVar(&usersFile, "from-file", "", "Create users from CSV or YAML file, - for CSV on stdin")
+	createCmd.Flags().IntVar(&bulkWorkers, "workers", 4, "Users created in parallel with --from-file")
+	createCmd.Flags().StringVar(&resultFile, "result-file", "", "Result file with keys for --from-file (default FILE.result.csv)")
+}
+
+// bulkUser is one row of a --from-file file
+type bulkUser struct {
+	Row         int    `yaml:"-"`
+	UID         string `yaml:"uid"`
+	DisplayName string `yaml:"displayName"`
+	Email       string `yaml:"email"`
+	Caps        string `yaml:"caps"`
+	Quota       string `yaml:"quota"`
+}
+
+type bulkResult struct {
+	Row       int    `json:"row"`
+	UID       string `json:"uid"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"-"`
+}
+
+var bulkResultHeader = []string{"row", "uid", "status", "error", "access_key", "secret_key"}
+
+// record is the result file row of the result.
+func (r bulkResult) record() []string {
+	return []string{strconv.Itoa(r.Row), r.UID, r.Status, r.Error, r.AccessKey, r.SecretKey}
+}
+
+func createUsersFromFile(path string) error {
+	if resultFile == "" {
+		if path == "-" {
+			return errMissingResultFile
+		}
+		resultFile = strings.TrimSuffix(path, filepath.Ext(path)) + ".result.csv"
+	}
+	if bulkWorkers < 1 {
+		bulkWorkers = 1
+	}
+
+	users, err := readBulkUsers(path)
+	if err != nil {
+		return err
+	}
+
+	// the result file holds secrets, it is never overwritten
+	out, err := os.OpenFile(resultFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	// rows are written as users are created, so the keys of created users
+	// are kept when the run is interrupted
+	w := csv.NewWriter(out)
+	w.Write(bulkResultHeader)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	var writeErr error
+
+	results := make(bulkResultList, len(users))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < bulkWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := createBulkUser(c, users[i])
+				results[i] = r
+
+				mu.Lock()
+				w.Write(r.record())
+				w.Flush()
+				if err := w.Error(); err != nil && writeErr == nil {
+					writeErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range users {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if writeErr != nil {
+		// print the keys, they can not be fetched again
+		fmt.Fprintf(os.Stderr, "Writing %s failed: %v\n", resultFile, writeErr)
+		w := csv.NewWriter(os.Stdout)
+		w.Write(bulkResultHeader)
+		for _, r := range results {
+			w.Write(r.record())
+		}
+		w.Flush()
+		return fmt.Errorf("%s: %w", resultFile, writeErr)
+	}
+
+	if err := printResource(results); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Keys written to %s\n", resultFile)
+	failed := 0
+	for _, r := range results {
+		// users created without their quota count as failed too
+		if r.Status != "created" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d users", errBulkFailed, failed, len(results))
+	}
+	return nil
+}
+
+func createBulkUser(c *admin.API, u bulkUser) bulkResult {
+	result := bulkResult{Row: u.Row, UID: u.UID, Status: "failed"}
+	if u.UID == "" {
+		result.Error = errMissingUserID.Error()
+		return result
+	}
+	quota, err := parseBulkQuota(u.Quota)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	displayName := u.DisplayName
+	if displayName == "" {
+		displayName = u.UID
+	}
+
+	created, err := c.CreateUser(context.Background(), admin.User{
+		ID:          u.UID,
+		DisplayName: displayName,
+		Email:       u.Email,
+		UserCaps:    u.Caps,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(created.Keys) > 0 {
+		result.AccessKey = created.Keys[0].AccessKey
+		result.SecretKey = created.Keys[0].SecretKey
+	}
+
+	if quota != nil {
+		quota.UID = u.UID
+		if err := c.SetUserQuota(context.Background(), *quota); err != nil {
+			result.Status = "created without quota"
+			result.Error = err.Error()
+			return result
+		}
+	}
+	result.Status = "created"
+	return result
+}
+
+// parseBulkQuota parses SIZE, SIZE/OBJECTS or /OBJECTS into an enabled quota.
+func parseBulkQuota(s string) (*admin.QuotaSpec, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	enabled := true
+	quota := &admin.QuotaSpec{Enabled: &enabled}
+	size, objects, _ := strings.Cut(s, "/")
+	if size = strings.TrimSpace(size); size != "" {
+		n, err := parseSize(size)
+		if err != nil {
+			return nil, err
+		}
+		quota.MaxSize = &n
+	}
+	if objects = strings.TrimSpace(objects); objects != "" {
+		n, err := strconv.ParseInt(objects, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidQuota, s)
+		}
+		quota.MaxObjects = &n
+	}
+	if quota.MaxSize == nil && quota.MaxObjects == nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidQuota, s)
+	}
+	return quota, nil
+}
+
+// readBulkUsers reads a YAML list from *.yaml and *.yml files, CSV otherwise.
+func readBulkUsers(path string) ([]bulkUser, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		var users []bulkUser
+		if err := yaml.NewDecoder(r).Decode(&users); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range users {
+			users[i].Row = i + 1
+		}
+		if len(users) == 0 {
+			return nil, errMissingUserID
+		}
+		return users, nil
+	}
+	return readBulkCSV(r)
+}
+
+func readBulkCSV(r io.Reader) ([]bulkUser, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		name = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+		columns[name] = i
+	}
+	if _, ok := columns["uid"]; !ok {
+		return nil, fmt.Errorf("%w: uid", errMissingColumn)
+	}
+
+	var users []bulkUser
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		users = append(users, bulkUser{
+			Row:         row,
+			UID:         field("uid"),
+			DisplayName: field("displayname"),
+			Email:       field("email"),
+			Caps:        field("caps"),
+			Quota:       field("quota"),
+		})
+	}
+	if len(users) == 0 {
+		return nil, errMissingUserID
+	}
+	return users, nil
+}
+
+type bulkResultList []bulkResult
+
+func (l bulkResultList) table() table {
+	t := table{headers: []string{"Row", "UID", "Status", "Access Key", "Error"}}
+	for _, r := range l {
+		t.rows = append(t.rows, []string{strconv.Itoa(r.Row), r.UID, r.Status, r.AccessKey, r.Error})
+	}
+	return t
+}
+
+func (l bulkResultList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, r := range l {
+		names = append(names, r.UID)
+	}
+	return names
+}
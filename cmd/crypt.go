@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/term"
+)
+
+const (
+	passphraseEnv    = "CEPHMGR_PASSPHRASE"
+	encryptedPrefix  = "enc:"
+	pbkdf2Iterations = 200000
+	// maxPbkdf2Iterations stops a crafted export from hanging the import
+	maxPbkdf2Iterations = 10000000
+)
+
+// secretCipher encrypts secrets with AES-256-GCM and a key derived from a
+// passphrase with PBKDF2-HMAC-SHA256.
+type secretCipher struct {
+	aead cipher.AEAD
+}
+
+func newSecretCipher(passphrase string, salt []byte, iterations int) (*secretCipher, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretCipher{aead: aead}, nil
+}
+
+// encrypt returns "enc:" followed by the base64 of the nonce and ciphertext.
+func (c *secretCipher) encrypt(secret string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt reverses encrypt, every secret of an encrypted export must be
+// encrypted.
+func (c *secretCipher) decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return "", errNotEncrypted
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", errWrongPassphrase
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errWrongPassphrase
+	}
+	return string(secret), nil
+}
+
+// readPassphrase returns the passphrase from CEPHMGR_PASSPHRASE, or asks for
+// it without echo. With repeat the passphrase is asked twice, so a typo can
+// not make an export impossible to decrypt.
+func readPassphrase(repeat bool) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	p, err := readSecretLine("Passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errMissingPassphrase
+	}
+	if repeat {
+		again, err := readSecretLine("Repeat passphrase:")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errPassphraseMismatch
+		}
+	}
+	return p, nil
+}
+
+// readSecretLine reads a line from the terminal without echo, or from stdin
+// when it is not a terminal.
+func readSecretLine(label string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return ReadKey(label), nil
+	}
+	fmt.Fprint(os.Stderr, label+" ")
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(p)), nil
+}
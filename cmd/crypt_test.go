@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSecretCipher(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	c, err := newSecretCipher("correct horse", salt, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"", "SECRET", "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "ümlaut €"} {
+		enc, err := c.encrypt(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(enc, encryptedPrefix) {
+			t.Errorf("encrypt(%q) = %q, want %s prefix", secret, enc, encryptedPrefix)
+		}
+		if secret != "" && strings.Contains(enc, secret) {
+			t.Errorf("encrypt(%q) = %q contains the secret", secret, enc)
+		}
+		again, _ := c.encrypt(secret)
+		if again == enc {
+			t.Errorf("encrypt(%q) reused the nonce", secret)
+		}
+		dec, err := c.decrypt(enc)
+		if err != nil || dec != secret {
+			t.Errorf("decrypt(encrypt(%q)) = %q, %v", secret, dec, err)
+		}
+	}
+}
+
+func TestSecretCipherDecrypt(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	c, _ := newSecretCipher("correct horse", salt, 1000)
+	enc, _ := c.encrypt("SECRET")
+
+	wrong, _ := newSecretCipher("wrong horse", salt, 1000)
+	otherSalt, _ := newSecretCipher("correct horse", []byte("fedcba9876543210"), 1000)
+	fewer, _ := newSecretCipher("correct horse", salt, 999)
+
+	tests := []struct {
+		name   string
+		cipher *secretCipher
+		in     string
+		want   string
+		err    error
+	}{
+		{"plain text", c, "SECRET", "", errNotEncrypted},
+		{"wrong passphrase", wrong, enc, "", errWrongPassphrase},
+		{"wrong salt", otherSalt, enc, "", errWrongPassphrase},
+		{"wrong iterations", fewer, enc, "", errWrongPassphrase},
+		{"not base64", c, encryptedPrefix + "!!", "", errWrongPassphrase},
+		{"too short", c, encryptedPrefix + "AAAA", "", errWrongPassphrase},
+		{"tampered", c, enc[:len(enc)-4] + "AAA=", "", errWrongPassphrase},
+	}
+	for _, tt := range tests {
+		got, err := tt.cipher.decrypt(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: decrypt = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+	colorBold  = "\033[1m"
+	colorReset = "\033[0m"
+
+	diffContext = 3
+)
+
+// diffCmd represents the diff command
+var (
+	diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Diff manifests against the cluster",
+		Long: `Show the difference between the cluster and manifests as a unified diff,
+see apply for the manifest format. Only the fields set in a manifest are
+compared.
+
+Exits with 0 when the cluster matches the manifests, 1 when it differs and
+2 on errors, e.g. to alert on manual changes in CI:
+
+cephmgr diff -f manifests/ --color never`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(manifestFiles) == 0 {
+				cmd.Help()
+				os.Exit(2)
+			}
+			drift, err := diffManifests(os.Stdout, manifestFiles)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if code := diffExitCode(drift, err); code != 0 {
+				os.Exit(code)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringSliceVarP(&manifestFiles, "filename", "f", nil, "Manifest file or directory, - for stdin")
+	diffCmd.Flags().StringVar(&diffColor, "color", "auto", "Colourise the diff: auto|always|never")
+	diffCmd.MarkFlagRequired("filename")
+}
+
+// diffManifests prints the diff of each manifest that differs from the
+// cluster and reports whether any did.
+func diffManifests(w io.Writer, paths []string) (bool, error) {
+	objects, err := readManifests(paths)
+	if err != nil {
+		return false, err
+	}
+	sortManifests(objects)
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return false, err
+	}
+
+	color := diffColor == "always" || diffColor == "auto" && isTerminal(os.Stdout)
+	drift := false
+	for _, o := range objects {
+		current, err := o.current(c)
+		if err != nil {
+			return drift, fmt.Errorf("%s: %w", o.ref(), err)
+		}
+		live := []string{}
+		if current != nil {
+			if live, err = manifestLines(current); err != nil {
+				return drift, err
+			}
+		}
+		desired, err := manifestLines(o)
+		if err != nil {
+			return drift, err
+		}
+
+		hunks := unifiedDiff(live, desired)
+		if len(hunks) == 0 {
+			continue
+		}
+		drift = true
+		printDiff(w, o.ref(), hunks, color)
+	}
+	return drift, nil
+}
+
+// diffExitCode is 0 when the cluster matches, 1 on drift and 2 on errors.
+func diffExitCode(drift bool, err error) int {
+	switch {
+	case err != nil:
+		return 2
+	case drift:
+		return 1
+	}
+	return 0
+}
+
+func manifestLines(o manifestObject) ([]string, error) {
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(2)
+	if err := e.Encode(o); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+type diffHunk struct {
+	fromLine, fromCount int
+	toLine, toCount     int
+	lines               []diffLine
+}
+
+// unifiedDiff returns the hunks turning a into b, with diffContext lines of
+// context around the changes.
+func unifiedDiff(a, b []string) []diffHunk {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		}
+	}
+
+	var hunks []diffHunk
+	for start := 0; start < len(lines); {
+		// find the next change and extend the hunk over changes separated by
+		// at most 2*diffContext lines, as diff -u does
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for k := first; k < len(lines) && k <= last+2*diffContext+1; k++ {
+			if lines[k].op != ' ' {
+				last = k
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		if from < 0 {
+			from = 0
+		}
+		to := last + diffContext + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		h := diffHunk{lines: lines[from:to]}
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				h.fromLine++
+			}
+			if l.op != '-' {
+				h.toLine++
+			}
+		}
+		for _, l := range h.lines {
+			if l.op != '+' {
+				h.fromCount++
+			}
+			if l.op != '-' {
+				h.toCount++
+			}
+		}
+		// line numbers are 1-based, an empty range names the line before it
+		if h.fromCount > 0 {
+			h.fromLine++
+		}
+		if h.toCount > 0 {
+			h.toLine++
+		}
+		hunks = append(hunks, h)
+		start = to
+	}
+	return hunks
+}
+
+func printDiff(w io.Writer, name string, hunks []diffHunk, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	fmt.Fprintln(w, paint(colorBold, "--- live/"+name))
+	fmt.Fprintln(w, paint(colorBold, "+++ manifest/"+name))
+	for _, h := range hunks {
+		fmt.Fprintln(w, paint(colorCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.fromLine, h.fromCount, h.toLine, h.toCount)))
+		for _, l := range h.lines {
+			line := string(l.op) + l.text
+			switch l.op {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(s string) []string {
+		if s == "" {
+			return []string{}
+		}
+		return strings.Split(s, " ")
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"identical", "a b c", "a b c", ""},
+		{"both empty", "", "", ""},
+		{"insert", "a b c d", "a b x c d", "@@ -1,4 +1,5 @@\n a\n b\n+x\n c\n d\n"},
+		{"delete", "a b c d", "a c d", "@@ -1,4 +1,3 @@\n a\n-b\n c\n d\n"},
+		{"change first", "a b c d e f", "x b c d e f", "@@ -1,4 +1,4 @@\n-a\n+x\n b\n c\n d\n"},
+		{"change last", "a b c d e f", "a b c d e x", "@@ -3,4 +3,4 @@\n c\n d\n e\n-f\n+x\n"},
+		{"from empty", "", "a b", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a b", "", "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{
+			"two hunks",
+			"a b c d e f g h i j k l",
+			"x b c d e f g h i j k y",
+			"@@ -1,4 +1,4 @@\n-a\n+x\n b\n c\n d\n@@ -9,4 +9,4 @@\n i\n j\n k\n-l\n+y\n",
+		},
+		{
+			"close changes in one hunk",
+			"a b c d e f g h",
+			"x b c d e f g y",
+			"@@ -1,8 +1,8 @@\n-a\n+x\n b\n c\n d\n e\n f\n g\n-h\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		hunks := unifiedDiff(lines(tt.a), lines(tt.b))
+		if len(hunks) > 0 {
+			printDiff(&out, "x", hunks, false)
+		}
+		want := ""
+		if tt.want != "" {
+			want = "--- live/x\n+++ manifest/x\n" + tt.want
+		}
+		if got := out.String(); got != want {
+			t.Errorf("%s: diff =\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/user" || r.URL.Query().Get("uid") != "alice" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Code": "NoSuchUser"}`))
+			return
+		}
+		w.Write([]byte(`{"user_id": "alice", "display_name": "Alice", "email": "alice@example.com", "max_buckets": 1000}`))
+	}))
+	defer server.Close()
+	cephHost, cephAccessKey, cephAccessSecret = server.URL, "key", "secret"
+	diffColor = "never"
+
+	dir := t.TempDir()
+	manifest := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	same := manifest("same.yaml", "kind: User\nuid: alice\ndisplayName: Alice\nmaxBuckets: 1000\n")
+	changed := manifest("changed.yaml", "kind: User\nuid: alice\ndisplayName: Alice\nmaxBuckets: 50\n")
+	missing := manifest("missing.yaml", "kind: User\nuid: bob\ndisplayName: Bob\n")
+	invalid := manifest("invalid.yaml", "kind: Nothing\n")
+
+	tests := []struct {
+		name string
+		path string
+		code int
+		want string
+	}{
+		{"in sync", same, 0, ""},
+		{"drift", changed, 1, "--- live/User/alice\n+++ manifest/User/alice\n@@ -1,4 +1,4 @@\n kind: User\n uid: alice\n displayName: Alice\n-maxBuckets: 1000\n+maxBuckets: 50\n"},
+		{"missing user", missing, 1, "--- live/User/bob\n+++ manifest/User/bob\n@@ -0,0 +1,3 @@\n+kind: User\n+uid: bob\n+displayName: Bob\n"},
+		{"invalid manifest", invalid, 2, ""},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		drift, err := diffManifests(&out, []string{tt.path})
+		if code := diffExitCode(drift, err); code != tt.code {
+			t.Errorf("%s: exit code = %d (%v), want %d", tt.name, code, err, tt.code)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: diff =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	if code := diffExitCode(true, errors.New("failed")); code != 2 {
+		t.Errorf("exit code with drift and error = %d, want 2", code)
+	}
+}
@@ -3,5 +3,48 @@ package cmd
 import "errors"
 
 var (
-	errMissingBucketID = errors.New("missing bucket name")
+	errMissingBucketID     = errors.New("missing bucket name")
+	errMissingUserID       = errors.New("missing user ID, use --user or --from-file")
+	errBulkFailed          = errors.New("operation failed")
+	errKeyNotCreated       = errors.New("new key not found in response")
+	errKeyNotFound         = errors.New("access key not found")
+	errAmbiguousKey        = errors.New("select the key with --access-key")
+	errInvalidSize         = errors.New("invalid size")
+	errClusterNotFound     = errors.New("cluster not found in config file")
+	errNoCurrentCluster    = errors.New("no cluster selected, use --cluster or set current-cluster in config file")
+	errUnknownOutputFormat = errors.New("unknown output format")
+	errInvalidJSONPath     = errors.New("invalid jsonpath template")
+	errUnknownSecretFormat = errors.New("unknown secret format")
+	errNothingToModify     = errors.New("nothing to modify, give at least one field flag")
+	errBucketOrUser        = errors.New("give either --bucket or --user")
+	errBucketNotEmpty      = errors.New("bucket not empty")
+	errNotConfirmed        = errors.New("not confirmed, nothing done")
+	errNoUserKey           = errors.New("user has no S3 key")
+	errSSECustomerKey      = errors.New("object is encrypted with a customer key (SSE-C)")
+	errInvalidSort         = errors.New("invalid sort key")
+	errInvalidTime         = errors.New("invalid time, use YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	errInvalidDuration     = errors.New("invalid duration, use e.g. 90d, 12w or 36h")
+	errMissingTrimEnd      = errors.New("one of --before or --keep is required")
+	errInvalidMonth        = errors.New("invalid month, use YYYY-MM")
+	errNoPricing           = errors.New("no pricing in config file")
+	errUnknownKind         = errors.New("unknown manifest kind")
+	errInvalidManifest     = errors.New("invalid manifest")
+	errInvalidCaps         = errors.New("invalid caps, use type=perm")
+	errWrongPassphrase     = errors.New("wrong passphrase or corrupted secret")
+	errMissingPassphrase   = errors.New("passphrase is required")
+	errUnknownConflict     = errors.New("unknown conflict mode, use skip, overwrite or fail")
+	errUserExists          = errors.New("users already exist")
+	errPassphraseMismatch  = errors.New("passphrases do not match")
+	errNotEncrypted        = errors.New("secret is not encrypted")
+	errInvalidIterations   = errors.New("invalid pbkdf2 iteration count")
+	errInvalidQuota        = errors.New("invalid quota, use SIZE, SIZE/OBJECTS or /OBJECTS")
+	errMissingColumn       = errors.New("missing column")
+	errMissingResultFile   = errors.New("--result-file is required when reading from stdin")
+	errSameCluster         = errors.New("source and target cluster are the same")
+	errInvalidBucketRef    = errors.New("invalid bucket, use CLUSTER:BUCKET or BUCKET")
+	errSyncFailed          = errors.New("sync failed")
+	errSameBucket          = errors.New("source and destination bucket are the same")
+	errInvalidS3URL        = errors.New("invalid S3 location, use s3://BUCKET/KEY")
+	errNoS3Side            = errors.New("one of source or destination must be s3://BUCKET/KEY")
+	errOwnerNeedsBucket    = errors.New("--owner needs a bucket, use --user to list the buckets of a user")
 )
@@ -0,0 +1,654 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Conflict modes of import
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictFail      = "fail"
+)
+
+// exportCmd represents the export command
+var (
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export users and bucket ownership",
+		Long: `Export every user with caps, keys, subusers and quotas, and the owner of
+every bucket, to a new YAML file written with 0600 permissions.
+
+Secret keys are encrypted with --encrypt (AES-256-GCM with a PBKDF2 derived
+key). The passphrase is read from CEPHMGR_PASSPHRASE or asked for twice.
+
+cephmgr export --out state.yaml --encrypt`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := exportUsers(stateFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Import users and bucket ownership",
+		Long: `Recreate users, caps, keys, subusers, quotas and bucket ownership from
+an export on the same or another cluster. Buckets are only re-linked, they
+must exist on the cluster.
+
+Existing users are handled with --on-conflict:
+  fail       import nothing when any user exists (default)
+  skip       keep existing users as they are
+  overwrite  update existing users, keys and subusers missing from the
+             export are kept
+
+cephmgr import -f state.yaml --on-conflict skip`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := importUsers(stateFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+
+	exportCmd.Flags().StringVar(&stateFile, "out", "", "Output file, - for stdout")
+	exportCmd.Flags().BoolVar(&stateEncrypt, "encrypt", false, "Encrypt secret keys")
+	exportCmd.MarkFlagRequired("out")
+
+	importCmd.Flags().StringVarP(&stateFile, "filename", "f", "", "Exported file, - for stdin")
+	importCmd.Flags().StringVar(&onConflict, "on-conflict", conflictFail, "Existing users: skip|overwrite|fail")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be imported")
+	importCmd.MarkFlagRequired("filename")
+}
+
+// clusterState is the exported identity state of a cluster
+type clusterState struct {
+	Exported   string           `json:"exported" yaml:"exported"`
+	Source     string           `json:"source" yaml:"source"`
+	Encryption *stateEncryption `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	Users      []userState      `json:"users" yaml:"users"`
+}
+
+// stateEncryption holds the parameters of encrypted secret keys
+type stateEncryption struct {
+	Cipher     string `json:"cipher" yaml:"cipher"`
+	KDF        string `json:"kdf" yaml:"kdf"`
+	Iterations int    `json:"iterations" yaml:"iterations"`
+	Salt       string `json:"salt" yaml:"salt"`
+}
+
+type userState struct {
+	UID              string         `json:"uid" yaml:"uid"`
+	DisplayName      string         `json:"displayName" yaml:"displayName"`
+	Email            string         `json:"email,omitempty" yaml:"email,omitempty"`
+	Suspended        bool           `json:"suspended,omitempty" yaml:"suspended,omitempty"`
+	MaxBuckets       *int           `json:"maxBuckets,omitempty" yaml:"maxBuckets,omitempty"`
+	OpMask           string         `json:"opMask,omitempty" yaml:"opMask,omitempty"`
+	DefaultPlacement string         `json:"defaultPlacement,omitempty" yaml:"defaultPlacement,omitempty"`
+	Caps             []string       `json:"caps,omitempty" yaml:"caps,omitempty"`
+	Keys             []keyState     `json:"keys,omitempty" yaml:"keys,omitempty"`
+	SwiftKeys        []keyState     `json:"swiftKeys,omitempty" yaml:"swiftKeys,omitempty"`
+	Subusers         []SubuserSpec  `json:"subusers,omitempty" yaml:"subusers,omitempty"`
+	Quota            *quotaManifest `json:"quota,omitempty" yaml:"quota,omitempty"`
+	BucketQuota      *quotaManifest `json:"bucketQuota,omitempty" yaml:"bucketQuota,omitempty"`
+	Buckets          []string       `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+
+	// generateKey creates the user with a new key instead of the keys above
+	generateKey bool
+}
+
+// keyState is an S3 or Swift key, User is the subuser for subuser keys
+type keyState struct {
+	User      string `json:"user" yaml:"user"`
+	AccessKey string `json:"accessKey,omitempty" yaml:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey" yaml:"secretKey"`
+}
+
+func exportUsers(path string) error {
+	// fail before the export when the file exists, it is not overwritten
+	if _, err := os.Stat(path); path != "-" && err == nil {
+		return fmt.Errorf("%s: %w", path, os.ErrExist)
+	}
+
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+	state, err := exportState(c, nil, true)
+	if err != nil {
+		return err
+	}
+
+	if stateEncrypt {
+		passphrase, err := readPassphrase(true)
+		if err != nil {
+			return err
+		}
+		if err := encryptState(&state, passphrase); err != nil {
+			return err
+		}
+	}
+
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := writeSecretFile(path, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d users to %s\n", len(state.Users), path)
+	return nil
+}
+
+// writeSecretFile writes data to a new file with 0600 permissions. An
+// existing file is never overwritten and a partly written file is removed.
+func writeSecretFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// exportState reads the users uids, or all users when uids is empty, and
+// with buckets the owners of all buckets.
+func exportState(c *admin.API, uids []string, buckets bool) (clusterState, error) {
+	state := clusterState{
+		Exported: time.Now().UTC().Format(time.RFC3339),
+		Source:   cephHost,
+		Users:    []userState{},
+	}
+
+	if len(uids) == 0 {
+		all, err := c.GetUsers(context.Background())
+		if err != nil {
+			return state, err
+		}
+		uids = *all
+	}
+	owned := map[string][]string{}
+	if buckets {
+		list, err := listBucketStats("")
+		if err != nil {
+			return state, err
+		}
+		for _, b := range list {
+			owned[b.Owner] = append(owned[b.Owner], b.Bucket)
+		}
+	}
+
+	uids = append([]string{}, uids...)
+	sort.Strings(uids)
+	for _, uid := range uids {
+		u, err := c.GetUser(context.Background(), admin.User{ID: uid})
+		if err != nil {
+			return state, fmt.Errorf("%s: %w", uid, err)
+		}
+		var user User
+		if err := remarshal(u, &user); err != nil {
+			return state, err
+		}
+		s, err := newUserState(user)
+		if err != nil {
+			return state, fmt.Errorf("%s: %w", uid, err)
+		}
+		s.Buckets = owned[uid]
+		sort.Strings(s.Buckets)
+		state.Users = append(state.Users, s)
+	}
+	return state, nil
+}
+
+func newUserState(u User) (userState, error) {
+	s := userState{
+		UID:              u.ID,
+		DisplayName:      u.DisplayName,
+		Email:            u.Email,
+		Suspended:        u.Suspended != nil && *u.Suspended != 0,
+		MaxBuckets:       u.MaxBuckets,
+		OpMask:           u.OpMask,
+		DefaultPlacement: u.DefaultPlacement,
+		Subusers:         u.Subusers,
+	}
+	var err error
+	caps := make([]string, 0, len(u.Caps))
+	for _, c := range u.Caps {
+		caps = append(caps, c.Type+"="+c.Perm)
+	}
+	if s.Caps, err = normalizeCaps(caps); err != nil {
+		return s, err
+	}
+	for _, k := range u.Keys {
+		s.Keys = append(s.Keys, keyState{User: k.User, AccessKey: k.AccessKey, SecretKey: k.SecretKey})
+	}
+	for _, k := range u.SwiftKeys {
+		s.SwiftKeys = append(s.SwiftKeys, keyState{User: k.User, SecretKey: k.SecretKey})
+	}
+
+	// all quota fields are kept, so that an import restores disabled limits
+	full := &quotaManifest{Enabled: new(bool), MaxSize: new(string), MaxObjects: new(int64)}
+	s.Quota = full.managed(u.UserQuota)
+	s.BucketQuota = full.managed(u.BucketQuota)
+	return s, nil
+}
+
+func encryptState(state *clusterState, passphrase string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	state.Encryption = &stateEncryption{
+		Cipher:     "aes-256-gcm",
+		KDF:        "pbkdf2-sha256",
+		Iterations: pbkdf2Iterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+	}
+	c, err := newSecretCipher(passphrase, salt, pbkdf2Iterations)
+	if err != nil {
+		return err
+	}
+	return transformSecrets(state, c.encrypt)
+}
+
+func decryptState(state *clusterState, passphrase string) error {
+	iterations := state.Encryption.Iterations
+	if iterations < pbkdf2Iterations || iterations > maxPbkdf2Iterations {
+		return fmt.Errorf("%w: %d", errInvalidIterations, iterations)
+	}
+	salt, err := base64.StdEncoding.DecodeString(state.Encryption.Salt)
+	if err != nil {
+		return err
+	}
+	c, err := newSecretCipher(passphrase, salt, iterations)
+	if err != nil {
+		return err
+	}
+	if err := transformSecrets(state, c.decrypt); err != nil {
+		return err
+	}
+	state.Encryption = nil
+	return nil
+}
+
+// transformSecrets replaces every secret key with f(secret).
+func transformSecrets(state *clusterState, f func(string) (string, error)) error {
+	for i := range state.Users {
+		u := &state.Users[i]
+		for _, keys := range [][]keyState{u.Keys, u.SwiftKeys} {
+			for j := range keys {
+				secret, err := f(keys[j].SecretKey)
+				if err != nil {
+					return fmt.Errorf("%s: %w", u.UID, err)
+				}
+				keys[j].SecretKey = secret
+			}
+		}
+	}
+	return nil
+}
+
+func importUsers(path string) error {
+	switch onConflict {
+	case conflictSkip, conflictOverwrite, conflictFail:
+	default:
+		return fmt.Errorf("%w: %s", errUnknownConflict, onConflict)
+	}
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	var state clusterState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if state.Encryption != nil {
+		passphrase, err := readPassphrase(false)
+		if err != nil {
+			return err
+		}
+		if err := decryptState(&state, passphrase); err != nil {
+			return err
+		}
+	}
+
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+	results, err := importState(c, state, onConflict)
+	if err != nil {
+		return err
+	}
+	if err := printResource(results); err != nil {
+		return err
+	}
+	if failed := results.failed(); failed > 0 {
+		return fmt.Errorf("%w: %d of %d users", errBulkFailed, failed, len(results))
+	}
+	return nil
+}
+
+// importState creates or updates the users of state on the cluster.
+func importState(c *admin.API, state clusterState, conflict string) (applyResultList, error) {
+	existing := map[string]*User{}
+	var conflicts []string
+	for _, s := range state.Users {
+		u, err := getManagedUser(c, s.UID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.UID, err)
+		}
+		if u != nil {
+			existing[s.UID] = u
+			conflicts = append(conflicts, s.UID)
+		}
+	}
+	if conflict == conflictFail && len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: %s", errUserExists, strings.Join(conflicts, ", "))
+	}
+
+	results := applyResultList{}
+	for _, s := range state.Users {
+		result := applyResult{Object: kindUser + "/" + s.UID, Changes: []string{}}
+		live := existing[s.UID]
+		result.Action = importAction(live != nil, conflict)
+		if result.Action != "skipped" {
+			changes, err := importUser(c, s, live, dryRun)
+			result.Changes = changes
+			if err != nil {
+				result.Action = "failed"
+				result.Changes = append(result.Changes, err.Error())
+			} else if dryRun {
+				result.Action += " (dry run)"
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importAction returns what import does with a user which exists or not.
+// Existing users fail the whole import before this with conflictFail.
+func importAction(exists bool, conflict string) string {
+	switch {
+	case exists && conflict == conflictSkip:
+		return "skipped"
+	case exists:
+		return "overwritten"
+	}
+	return "created"
+}
+
+// importUser creates the user, or updates the live user, and returns what
+// changed. Nothing is changed in dry run.
+func importUser(c *admin.API, s userState, live *User, dryRun bool) ([]string, error) {
+	var changes []string
+	ctx := context.Background()
+	suspended := 0
+	if s.Suspended {
+		suspended = 1
+	}
+	user := admin.User{ID: s.UID, DisplayName: s.DisplayName, Email: s.Email, MaxBuckets: s.MaxBuckets, Suspended: &suspended}
+
+	liveState := userState{}
+	if live == nil {
+		changes = append(changes, "user")
+		if !dryRun {
+			// keys are imported below with their exact values
+			generate := s.generateKey
+			user.GenerateKey = &generate
+			user.UserCaps = strings.Join(s.Caps, ";")
+			if _, err := c.CreateUser(ctx, user); err != nil {
+				return changes, err
+			}
+		}
+		// caps are set on creation
+		liveState.Caps = s.Caps
+	} else {
+		var err error
+		if liveState, err = newUserState(*live); err != nil {
+			return nil, err
+		}
+		if s.DisplayName != liveState.DisplayName || s.Email != liveState.Email || s.Suspended != liveState.Suspended ||
+			!reflect.DeepEqual(s.MaxBuckets, liveState.MaxBuckets) {
+			changes = append(changes, "user")
+			if !dryRun {
+				if _, err := c.ModifyUser(ctx, user); err != nil {
+					return changes, err
+				}
+			}
+		}
+	}
+
+	if s.OpMask != liveState.OpMask || s.DefaultPlacement != liveState.DefaultPlacement {
+		args := url.Values{"uid": {s.UID}}
+		if s.OpMask != "" {
+			args.Set("op-mask", s.OpMask)
+		}
+		if s.DefaultPlacement != "" {
+			args.Set("default-placement", s.DefaultPlacement)
+		}
+		if len(args) > 1 {
+			changes = append(changes, "op mask and placement")
+			if !dryRun {
+				if _, err := adminCall(ctx, http.MethodPost, "/user", args); err != nil {
+					return changes, err
+				}
+			}
+		}
+	}
+
+	if s.Caps == nil {
+		s.Caps = []string{}
+	}
+	if liveState.Caps == nil {
+		liveState.Caps = []string{}
+	}
+	if !reflect.DeepEqual(s.Caps, liveState.Caps) {
+		changes = append(changes, "caps")
+		if !dryRun {
+			if err := updateCaps(c, s.UID, s.Caps, liveState.Caps); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	liveSubusers := map[string]string{}
+	for _, su := range liveState.Subusers {
+		liveSubusers[su.ID] = su.Permissions
+	}
+	for _, su := range s.Subusers {
+		perm, ok := liveSubusers[su.ID]
+		if ok && perm == su.Permissions {
+			continue
+		}
+		changes = append(changes, "subuser "+su.ID)
+		if dryRun {
+			continue
+		}
+		spec := admin.SubuserSpec{Name: su.ID, Access: subuserAccessLevel(su.Permissions)}
+		var err error
+		if ok {
+			err = c.ModifySubuser(ctx, admin.User{ID: s.UID}, spec)
+		} else {
+			err = c.CreateSubuser(ctx, admin.User{ID: s.UID}, spec)
+		}
+		if err != nil {
+			return changes, err
+		}
+	}
+
+	liveKeys := map[string]string{}
+	for _, k := range liveState.Keys {
+		liveKeys[k.AccessKey] = k.SecretKey
+	}
+	for _, k := range liveState.SwiftKeys {
+		liveKeys[k.User] = k.SecretKey
+	}
+	for _, k := range s.Keys {
+		if secret, ok := liveKeys[k.AccessKey]; ok && secret == k.SecretKey {
+			continue
+		}
+		changes = append(changes, "key "+k.AccessKey)
+		if !dryRun {
+			if err := putStateKey(s.UID, keyTypeS3, k); err != nil {
+				return changes, err
+			}
+		}
+	}
+	for _, k := range s.SwiftKeys {
+		if secret, ok := liveKeys[k.User]; ok && secret == k.SecretKey {
+			continue
+		}
+		changes = append(changes, "swift key "+k.User)
+		if !dryRun {
+			if err := putStateKey(s.UID, keyTypeSwift, k); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	if s.Quota != nil && !reflect.DeepEqual(s.Quota, liveState.Quota) {
+		changes = append(changes, "quota")
+		if !dryRun {
+			quota := s.Quota.spec()
+			quota.UID = s.UID
+			if err := c.SetUserQuota(ctx, quota); err != nil {
+				return changes, err
+			}
+		}
+	}
+	if s.BucketQuota != nil && !reflect.DeepEqual(s.BucketQuota, liveState.BucketQuota) {
+		changes = append(changes, "bucket quota")
+		if !dryRun {
+			if err := putBucketQuota("", s.UID, s.BucketQuota.spec()); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	for _, bucket := range s.Buckets {
+		b, err := getBucket(bucket)
+		if errors.Is(err, admin.ErrNoSuchBucket) {
+			changes = append(changes, "bucket "+bucket+" missing")
+			continue
+		}
+		if err != nil {
+			return changes, err
+		}
+		if b.Owner == s.UID {
+			continue
+		}
+		changes = append(changes, "link "+bucket)
+		if !dryRun {
+			err := c.LinkBucket(ctx, admin.BucketLinkInput{Bucket: b.Bucket, BucketID: b.ID, UID: s.UID})
+			if err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// putStateKey creates or replaces an S3 or Swift key of the user or subuser.
+func putStateKey(uid, keyType string, k keyState) error {
+	args := url.Values{"uid": {uid}, "key-type": {keyType}, "secret-key": {k.SecretKey}}
+	if k.User != uid {
+		args.Set("subuser", k.User)
+	}
+	if k.AccessKey != "" {
+		args.Set("access-key", k.AccessKey)
+	}
+	_, err := adminCall(context.Background(), http.MethodPut, "/user?key", args)
+	return err
+}
+
+// subuserAccessLevel maps the permissions RGW reports to the access level
+// subusers are created with.
+func subuserAccessLevel(permissions string) admin.SubuserAccess {
+	switch permissions {
+	case "full-control":
+		return admin.SubuserAccessFull
+	case "read-write":
+		return admin.SubuserAccessReadWrite
+	case "read":
+		return admin.SubuserAccessRead
+	case "write":
+		return admin.SubuserAccessWrite
+	}
+	return admin.SubuserAccessNone
+}
+
+func (l applyResultList) failed() int {
+	failed := 0
+	for _, r := range l {
+		if r.Action == "failed" {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewUserState(t *testing.T) {
+	enabled, suspended, maxBuckets := true, 1, 10
+	size, objects := int64(500<<30), int64(-1)
+	u := User{
+		ID:          "alice",
+		DisplayName: "Alice",
+		Email:       "alice@example.com",
+		Suspended:   &suspended,
+		MaxBuckets:  &maxBuckets,
+		OpMask:      "read, write",
+		Caps:        []UserCapSpec{{Type: "users", Perm: "read"}, {Type: "buckets", Perm: "*"}},
+		Keys:        []UserKeySpec{{User: "alice", AccessKey: "AK1", SecretKey: "SK1"}},
+		SwiftKeys:   []SwiftKeySpec{{User: "alice:swift", SecretKey: "SWIFT"}},
+		Subusers:    []SubuserSpec{{ID: "alice:swift", Permissions: "full-control"}},
+		UserQuota:   QuotaSpec{Enabled: &enabled, MaxSize: &size, MaxObjects: &objects},
+	}
+
+	s, err := newUserState(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := func(enabled bool, size string, objects int64) *quotaManifest {
+		return &quotaManifest{Enabled: &enabled, MaxSize: &size, MaxObjects: &objects}
+	}
+	want := userState{
+		UID:         "alice",
+		DisplayName: "Alice",
+		Email:       "alice@example.com",
+		Suspended:   true,
+		MaxBuckets:  &maxBuckets,
+		OpMask:      "read, write",
+		Caps:        []string{"buckets=*", "users=read"},
+		Keys:        []keyState{{User: "alice", AccessKey: "AK1", SecretKey: "SK1"}},
+		SwiftKeys:   []keyState{{User: "alice:swift", SecretKey: "SWIFT"}},
+		Subusers:    []SubuserSpec{{ID: "alice:swift", Permissions: "full-control"}},
+		Quota:       quota(true, "500G", -1),
+		BucketQuota: quota(false, "-1", -1),
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("newUserState =\n%+v\nwant\n%+v", s, want)
+	}
+
+	u.Caps = []UserCapSpec{{Type: "users", Perm: "bogus"}}
+	if _, err := newUserState(u); err == nil {
+		t.Error("newUserState with invalid caps succeeded")
+	}
+}
+
+func TestStateEncryption(t *testing.T) {
+	state := clusterState{Users: []userState{
+		{UID: "alice", Keys: []keyState{{User: "alice", AccessKey: "AK1", SecretKey: "SK1"}}},
+		{UID: "bob", SwiftKeys: []keyState{{User: "bob:swift", SecretKey: "SWIFT"}}},
+		{UID: "carol"},
+	}}
+	plain := clusterState{Users: []userState{
+		{UID: "alice", Keys: []keyState{{User: "alice", AccessKey: "AK1", SecretKey: "SK1"}}},
+		{UID: "bob", SwiftKeys: []keyState{{User: "bob:swift", SecretKey: "SWIFT"}}},
+		{UID: "carol"},
+	}}
+
+	if err := encryptState(&state, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if state.Encryption == nil || state.Encryption.Iterations != pbkdf2Iterations {
+		t.Fatalf("encryption = %+v", state.Encryption)
+	}
+	if got := state.Users[0].Keys[0]; got.SecretKey == "SK1" || got.AccessKey != "AK1" {
+		t.Errorf("encrypted key = %+v", got)
+	}
+	if got := state.Users[1].SwiftKeys[0].SecretKey; got == "SWIFT" {
+		t.Errorf("swift key not encrypted")
+	}
+
+	encrypted := state
+	encrypted.Users = append([]userState{}, state.Users...)
+	if err := decryptState(&encrypted, "wrong"); err == nil {
+		t.Error("decryptState with wrong passphrase succeeded")
+	}
+	for _, iterations := range []int{0, 1000, maxPbkdf2Iterations + 1} {
+		weak := encrypted
+		weak.Encryption = &stateEncryption{Salt: state.Encryption.Salt, Iterations: iterations}
+		if err := decryptState(&weak, "passphrase"); !errors.Is(err, errInvalidIterations) {
+			t.Errorf("decryptState with %d iterations = %v, want %v", iterations, err, errInvalidIterations)
+		}
+	}
+	plainSecret := encrypted
+	plainSecret.Users = []userState{{UID: "dave", Keys: []keyState{{User: "dave", AccessKey: "AK2", SecretKey: "SK2"}}}}
+	if err := decryptState(&plainSecret, "passphrase"); !errors.Is(err, errNotEncrypted) {
+		t.Errorf("decryptState with a plain text secret = %v, want %v", err, errNotEncrypted)
+	}
+
+	if err := decryptState(&state, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, plain) {
+		t.Errorf("decrypted state =\n%+v\nwant\n%+v", state, plain)
+	}
+}
+
+func TestImportAction(t *testing.T) {
+	tests := []struct {
+		exists   bool
+		conflict string
+		want     string
+	}{
+		{false, conflictSkip, "created"},
+		{false, conflictOverwrite, "created"},
+		{false, conflictFail, "created"},
+		{true, conflictSkip, "skipped"},
+		{true, conflictOverwrite, "overwritten"},
+	}
+	for _, tt := range tests {
+		if got := importAction(tt.exists, tt.conflict); got != tt.want {
+			t.Errorf("importAction(%v, %s) = %s, want %s", tt.exists, tt.conflict, got, tt.want)
+		}
+	}
+}
+
+func TestImportUserChanges(t *testing.T) {
+	live := &User{
+		ID:          "alice",
+		DisplayName: "Alice",
+		Caps:        []UserCapSpec{{Type: "users", Perm: "read"}},
+		Keys: []UserKeySpec{
+			{User: "alice", AccessKey: "AK1", SecretKey: "SK1"},
+			{User: "alice", AccessKey: "AK2", SecretKey: "SK2"},
+		},
+		SwiftKeys: []SwiftKeySpec{{User: "alice:swift", SecretKey: "SWIFT"}},
+		Subusers: []SubuserSpec{
+			{ID: "alice:swift", Permissions: "full-control"},
+			{ID: "alice:ro", Permissions: "read"},
+		},
+	}
+	same, err := newUserState(*live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same.Quota, same.BucketQuota = nil, nil
+
+	tests := []struct {
+		name   string
+		change func(s *userState)
+		live   *User
+		want   []string
+	}{
+		{"unchanged", func(s *userState) {}, live, nil},
+		{"new user", func(s *userState) {}, nil, []string{"user", "subuser alice:swift", "subuser alice:ro", "key AK1", "key AK2", "swift key alice:swift"}},
+		{"display name", func(s *userState) { s.DisplayName = "Alice Smith" }, live, []string{"user"}},
+		{"caps", func(s *userState) { s.Caps = []string{"users=*"} }, live, []string{"caps"}},
+		{"new key", func(s *userState) {
+			s.Keys = append(s.Keys, keyState{User: "alice", AccessKey: "AK3", SecretKey: "SK3"})
+		}, live, []string{"key AK3"}},
+		{"changed secret", func(s *userState) { s.Keys = []keyState{{User: "alice", AccessKey: "AK1", SecretKey: "NEW"}} }, live, []string{"key AK1"}},
+		{"removed key is kept", func(s *userState) { s.Keys = s.Keys[:1] }, live, nil},
+		{"swift secret", func(s *userState) { s.SwiftKeys = []keyState{{User: "alice:swift", SecretKey: "NEW"}} }, live, []string{"swift key alice:swift"}},
+		{"subuser access", func(s *userState) {
+			s.Subusers = []SubuserSpec{{ID: "alice:ro", Permissions: "read-write"}}
+		}, live, []string{"subuser alice:ro"}},
+		{"new subuser", func(s *userState) {
+			s.Subusers = append(s.Subusers, SubuserSpec{ID: "alice:rw", Permissions: "read-write"})
+		}, live, []string{"subuser alice:rw"}},
+	}
+	for _, tt := range tests {
+		s := same
+		s.Keys = append([]keyState{}, same.Keys...)
+		s.Subusers = append([]SubuserSpec{}, same.Subusers...)
+		tt.change(&s)
+		changes, err := importUser(nil, s, tt.live, true)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(changes, tt.want) {
+			t.Errorf("%s: changes = %q, want %q", tt.name, changes, tt.want)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a kubectl style JSONPath template. It supports field, index,
+// slice, wildcard, recursive descent and filter selectors, string literals
+// and range/end blocks:
+//
+//	{.keys[*].access_key}
+//	{range .caps[*]}{.type}={.perm}{"\n"}{end}
+//	{.keys[?(@.user=="alice")].access_key}
+type jsonPath struct {
+	nodes []jpNode
+}
+
+type jpNode struct {
+	text  string
+	path  []jpStep
+	rng   bool
+	body  []jpNode
+	isLit bool
+}
+
+type jpStep struct {
+	kind   string // root, field, recursive, index, slice, wildcard, filter
+	name   string
+	index  int
+	start  *int
+	end    *int
+	filter *jpFilter
+}
+
+type jpFilter struct {
+	path  []jpStep
+	op    string
+	value interface{}
+}
+
+func parseJSONPath(template string) (*jsonPath, error) {
+	nodes, rest, err := parseJPNodes(template, false)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("%w: unexpected {end}", errInvalidJSONPath)
+	}
+	return &jsonPath{nodes: nodes}, nil
+}
+
+// parseJPNodes parses template up to the end of the template or, inside a
+// range block, up to the matching {end}, returning the unparsed remainder.
+func parseJPNodes(template string, inRange bool) ([]jpNode, string, error) {
+	var nodes []jpNode
+	for template != "" {
+		open := strings.Index(template, "{")
+		if open < 0 {
+			nodes = append(nodes, jpNode{text: template, isLit: true})
+			template = ""
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, jpNode{text: template[:open], isLit: true})
+		}
+
+		end := matchingBrace(template, open)
+		if end < 0 {
+			return nil, "", fmt.Errorf("%w: unclosed { in %q", errInvalidJSONPath, template)
+		}
+		expr := strings.TrimSpace(template[open+1 : end])
+		template = template[end+1:]
+
+		switch {
+		case expr == "end":
+			if !inRange {
+				return nodes, "{end}" + template, nil
+			}
+			return nodes, template, nil
+		case strings.HasPrefix(expr, "range "):
+			path, err := parseJPPath(strings.TrimSpace(strings.TrimPrefix(expr, "range ")))
+			if err != nil {
+				return nil, "", err
+			}
+			body, rest, err := parseJPNodes(template, true)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, jpNode{rng: true, path: path, body: body})
+			template = rest
+		case strings.HasPrefix(expr, `"`):
+			s, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, "", fmt.Errorf("%w: %s", errInvalidJSONPath, expr)
+			}
+			nodes = append(nodes, jpNode{text: s, isLit: true})
+		default:
+			path, err := parseJPPath(expr)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, jpNode{path: path})
+		}
+	}
+	if inRange {
+		return nil, "", fmt.Errorf("%w: missing {end}", errInvalidJSONPath)
+	}
+	return nodes, "", nil
+}
+
+func matchingBrace(s string, open int) int {
+	depth := 0
+	quote := byte(0)
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseJPPath(expr string) ([]jpStep, error) {
+	var steps []jpStep
+	if strings.HasPrefix(expr, "$") {
+		steps = append(steps, jpStep{kind: "root"})
+	}
+	s := strings.TrimPrefix(strings.TrimPrefix(expr, "$"), "@")
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			name, rest := jpName(s[2:])
+			steps = append(steps, jpStep{kind: "recursive", name: name})
+			s = rest
+		case s[0] == '.':
+			name, rest := jpName(s[1:])
+			if name == "" {
+				// a lone "." selects the current object
+				s = rest
+				continue
+			}
+			if name == "*" {
+				steps = append(steps, jpStep{kind: "wildcard"})
+			} else {
+				steps = append(steps, jpStep{kind: "field", name: name})
+			}
+			s = rest
+		case s[0] == '[':
+			end := matchingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed [ in %q", errInvalidJSONPath, expr)
+			}
+			step, err := parseJPSubscript(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+			s = s[end+1:]
+		default:
+			name, rest := jpName(s)
+			if name == "" {
+				return nil, fmt.Errorf("%w: %q", errInvalidJSONPath, expr)
+			}
+			steps = append(steps, jpStep{kind: "field", name: name})
+			s = rest
+		}
+	}
+	return steps, nil
+}
+
+func jpName(s string) (string, string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+func matchingBracket(s string) int {
+	quote := byte(0)
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseJPSubscript(sub string) (jpStep, error) {
+	switch {
+	case sub == "*":
+		return jpStep{kind: "wildcard"}, nil
+	case strings.HasPrefix(sub, "?(") && strings.HasSuffix(sub, ")"):
+		f, err := parseJPFilter(strings.TrimSpace(sub[2 : len(sub)-1]))
+		if err != nil {
+			return jpStep{}, err
+		}
+		return jpStep{kind: "filter", filter: f}, nil
+	case strings.HasPrefix(sub, "'") || strings.HasPrefix(sub, `"`):
+		return jpStep{kind: "field", name: strings.Trim(sub, `'"`)}, nil
+	case strings.Contains(sub, ":"):
+		parts := strings.SplitN(sub, ":", 2)
+		step := jpStep{kind: "slice"}
+		for i, p := range parts {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return jpStep{}, fmt.Errorf("%w: [%s]", errInvalidJSONPath, sub)
+			}
+			if i == 0 {
+				step.start = &n
+			} else {
+				step.end = &n
+			}
+		}
+		return step, nil
+	default:
+		n, err := strconv.Atoi(sub)
+		if err != nil {
+			return jpStep{}, fmt.Errorf("%w: [%s]", errInvalidJSONPath, sub)
+		}
+		return jpStep{kind: "index", index: n}, nil
+	}
+}
+
+func parseJPFilter(expr string) (*jpFilter, error) {
+	if i, op := jpOperator(expr); op != "" {
+		path, err := parseJPPath(strings.TrimSpace(expr[:i]))
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		lit := strings.TrimSpace(expr[i+len(op):])
+		if len(lit) >= 2 && (lit[0] == '\'' || lit[0] == '"') && lit[len(lit)-1] == lit[0] {
+			value = lit[1 : len(lit)-1]
+		} else if err := json.Unmarshal([]byte(lit), &value); err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidJSONPath, lit)
+		}
+		return &jpFilter{path: path, op: op, value: value}, nil
+	}
+
+	path, err := parseJPPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &jpFilter{path: path}, nil
+}
+
+// jpOperator returns the position of the first comparison operator in a
+// filter expression outside quoted literals.
+func jpOperator(expr string) (int, string) {
+	quote := byte(0)
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+				if strings.HasPrefix(expr[i:], op) {
+					return i, op
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+// execute writes the template for data, which must hold the generic JSON
+// form of the object (maps, slices and scalars).
+func (j *jsonPath) execute(w io.Writer, data interface{}) error {
+	return executeJPNodes(w, j.nodes, data, data)
+}
+
+func executeJPNodes(w io.Writer, nodes []jpNode, root, current interface{}) error {
+	for _, n := range nodes {
+		switch {
+		case n.isLit:
+			fmt.Fprint(w, n.text)
+		case n.rng:
+			for _, v := range evalJPPath(n.path, root, current) {
+				if err := executeJPNodes(w, n.body, root, v); err != nil {
+					return err
+				}
+			}
+		default:
+			values := evalJPPath(n.path, root, current)
+			s := make([]string, 0, len(values))
+			for _, v := range values {
+				text, err := jpText(v)
+				if err != nil {
+					return err
+				}
+				s = append(s, text)
+			}
+			fmt.Fprint(w, strings.Join(s, " "))
+		}
+	}
+	return nil
+}
+
+func jpText(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case float64:
+		// JSON numbers decode as float64, print sizes without exponent
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func evalJPPath(steps []jpStep, root, current interface{}) []interface{} {
+	values := []interface{}{current}
+	for _, step := range steps {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, evalJPStep(step, root, v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func evalJPStep(step jpStep, root, v interface{}) []interface{} {
+	switch step.kind {
+	case "root":
+		return []interface{}{root}
+	case "field":
+		if m, ok := v.(map[string]interface{}); ok {
+			if f, ok := m[step.name]; ok {
+				return []interface{}{f}
+			}
+		}
+	case "wildcard":
+		return jpChildren(v)
+	case "recursive":
+		var found []interface{}
+		jpWalk(v, func(c interface{}) {
+			if step.name == "*" || step.name == "" {
+				found = append(found, jpChildren(c)...)
+				return
+			}
+			if m, ok := c.(map[string]interface{}); ok {
+				if f, ok := m[step.name]; ok {
+					found = append(found, f)
+				}
+			}
+		})
+		return found
+	case "index":
+		if a, ok := v.([]interface{}); ok {
+			i := step.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				return []interface{}{a[i]}
+			}
+		}
+	case "slice":
+		if a, ok := v.([]interface{}); ok {
+			start, end := 0, len(a)
+			if step.start != nil {
+				start = clampIndex(*step.start, len(a))
+			}
+			if step.end != nil {
+				end = clampIndex(*step.end, len(a))
+			}
+			if start < end {
+				return a[start:end]
+			}
+		}
+	case "filter":
+		var found []interface{}
+		for _, c := range jpChildren(v) {
+			if step.filter.match(root, c) {
+				found = append(found, c)
+			}
+		}
+		return found
+	}
+	return nil
+}
+
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+func jpChildren(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		children := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			children = append(children, v[k])
+		}
+		return children
+	}
+	return nil
+}
+
+func jpWalk(v interface{}, fn func(interface{})) {
+	fn(v)
+	for _, c := range jpChildren(v) {
+		jpWalk(c, fn)
+	}
+}
+
+func (f *jpFilter) match(root, v interface{}) bool {
+	values := evalJPPath(f.path, root, v)
+	if f.op == "" {
+		return len(values) > 0
+	}
+	for _, got := range values {
+		if compareJP(got, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareJP(got interface{}, op string, want interface{}) bool {
+	gf, gok := got.(float64)
+	wf, wok := want.(float64)
+	if gok && wok {
+		switch op {
+		case "==":
+			return gf == wf
+		case "!=":
+			return gf != wf
+		case "<":
+			return gf < wf
+		case "<=":
+			return gf <= wf
+		case ">":
+			return gf > wf
+		case ">=":
+			return gf >= wf
+		}
+	}
+	switch op {
+	case "==":
+		return reflect.DeepEqual(got, want)
+	case "!=":
+		return !reflect.DeepEqual(got, want)
+	}
+	return false
+}
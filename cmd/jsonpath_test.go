@@ -0,0 +1,127 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const jsonPathUser = `{
+	"user_id": "alice",
+	"max_buckets": 1000,
+	"size": 1099511627776,
+	"keys": [
+		{"user": "alice", "access_key": "AK1", "secret_key": "SK1"},
+		{"user": "alice:swift", "access_key": "AK2", "secret_key": "SK2"},
+		{"user": "a<'x==y'", "access_key": "AK3", "secret_key": "SK3"}
+	],
+	"caps": [
+		{"type": "users", "perm": "*"},
+		{"type": "buckets", "perm": "read"}
+	],
+	"stats": {"size": 10, "num_objects": 2}
+}`
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonPathUser), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{.user_id}`, "alice"},
+		{`{$.user_id}`, "alice"},
+		{`{.max_buckets}`, "1000"},
+		{`{.size}`, "1099511627776"},
+		{`{.keys[*].access_key}`, "AK1 AK2 AK3"},
+		{`{.keys[0].access_key}`, "AK1"},
+		{`{.keys[-1].access_key}`, "AK3"},
+		{`{.keys[1:].access_key}`, "AK2 AK3"},
+		{`{.keys[:1].access_key}`, "AK1"},
+		{`{.keys[5].access_key}`, ""},
+		{`{.keys[?(@.user=="alice")].secret_key}`, "SK1"},
+		{`{.keys[?(@.user!="alice")].access_key}`, "AK2 AK3"},
+		{`{.keys[?(@.user=="a<'x==y'")].access_key}`, "AK3"},
+		{`{.caps[?(@.perm)].type}`, "users buckets"},
+		{`{.stats[?(@ > 5)]}`, "10"},
+		{`{..num_objects}`, "2"},
+		{`{.stats}`, `{"num_objects":2,"size":10}`},
+		{`{range .caps[*]}{.type}={.perm}{"\n"}{end}`, "users=*\nbuckets=read\n"},
+		{`key: {.keys[0]['access_key']}`, "key: AK1"},
+	}
+	for _, tt := range tests {
+		jp, err := parseJSONPath(tt.template)
+		if err != nil {
+			t.Errorf("parseJSONPath(%q): %v", tt.template, err)
+			continue
+		}
+		var out strings.Builder
+		if err := jp.execute(&out, data); err != nil {
+			t.Errorf("execute(%q): %v", tt.template, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("execute(%q) = %q, want %q", tt.template, out.String(), tt.want)
+		}
+	}
+}
+
+func TestJSONPathInvalid(t *testing.T) {
+	for _, template := range []string{
+		`{.keys`,
+		`{.keys[0}`,
+		`{.keys[x]}`,
+		`{range .keys[*]}{.user}`,
+		`{.user}{end}`,
+		`{.keys[?(@.user==alice)]}`,
+	} {
+		if _, err := parseJSONPath(template); !errors.Is(err, errInvalidJSONPath) {
+			t.Errorf("parseJSONPath(%q) = %v, want %v", template, err, errInvalidJSONPath)
+		}
+	}
+}
+
+func TestJSONPathOperator(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		op   string
+	}{
+		{`@.a=="b"`, 3, "=="},
+		{`@.a<'x==y'`, 3, "<"},
+		{`@.a<="x"`, 3, "<="},
+		{`@.a=='<'`, 3, "=="},
+		{`@.a`, -1, ""},
+	}
+	for _, tt := range tests {
+		pos, op := jpOperator(tt.expr)
+		if pos != tt.pos || op != tt.op {
+			t.Errorf("jpOperator(%q) = %d, %q, want %d, %q", tt.expr, pos, op, tt.pos, tt.op)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// keyCmd represents the key command
+var (
+	keyCmd = &cobra.Command{
+		Use:   "key",
+		Short: "User S3 keys operations",
+		Long:  `List, create, remove and rotate user S3 access keys`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	listKeysCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List user keys",
+		Long:  `List user S3 access keys`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := listKeys(userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	createKeyCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create user key",
+		Long: `Create a new S3 key for user.
+
+The key is generated unless --access-key and --secret-key are given.
+Secret keys are not shown unless --show-secrets is given, save the new
+key to a file with --secret-output-file and --secret-format.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			key := &UserKeySpec{
+				User:      userName,
+				AccessKey: keyAccessKey,
+				SecretKey: keySecretKey,
+			}
+			err := createKey(*key)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	removeKeyCmd = &cobra.Command{
+		Use:   "remove",
+		Short: "Remove user key",
+		Long:  `Remove user S3 key given with --access-key`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" || keyAccessKey == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := removeKey(userName, keyAccessKey)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	rotateKeyCmd = &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate user key",
+		Long: `Replace user S3 key with a new generated key.
+
+The key given with --access-key is rotated, it can be left out when the user
+has only one key. The new key can be tested against the S3 endpoint with
+--verify before the old key is removed. The old key is removed after the
+--grace period, or after confirmation when no grace period is given:
+
+cephmgr rgw user key rotate --user alice --verify --grace 10m`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := rotateKey(userName, keyAccessKey)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	userCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(listKeysCmd)
+	keyCmd.AddCommand(createKeyCmd)
+	keyCmd.AddCommand(removeKeyCmd)
+	keyCmd.AddCommand(rotateKeyCmd)
+
+	createKeyCmd.Flags().StringVar(&keyAccessKey, "access-key", "", "Access key, generated when not given")
+	createKeyCmd.Flags().StringVar(&keySecretKey, "secret-key", "", "Secret key, generated when not given")
+	createKeyCmd.Flags().StringVar(&secretOutputFile, "secret-output-file", "", "Write credentials to file (created with 0600 permissions)")
+	createKeyCmd.Flags().StringVar(&secretFormat, "secret-format", "", "Credentials format: env|aws-credentials|s3cfg|rclone (default env)")
+
+	removeKeyCmd.Flags().StringVar(&keyAccessKey, "access-key", "", "Access key to remove")
+	removeKeyCmd.MarkFlagRequired("access-key")
+
+	rotateKeyCmd.Flags().StringVar(&keyAccessKey, "access-key", "", "Access key to rotate")
+	rotateKeyCmd.Flags().BoolVar(&keyVerify, "verify", false, "Verify new key against S3 endpoint before removing old key")
+	rotateKeyCmd.Flags().DurationVar(&keyGrace, "grace", 0, "Wait before removing old key, e.g. 10m")
+	rotateKeyCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Remove old key without confirmation")
+	rotateKeyCmd.Flags().StringVar(&secretOutputFile, "secret-output-file", "", "Write credentials to file (created with 0600 permissions)")
+	rotateKeyCmd.Flags().StringVar(&secretFormat, "secret-format", "", "Credentials format: env|aws-credentials|s3cfg|rclone (default env)")
+}
+
+func getKeys(uid string) ([]UserKeySpec, error) {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []UserKeySpec
+	if err := remarshal(u.Keys, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func listKeys(uid string) error {
+	keys, err := getKeys(uid)
+	if err != nil {
+		return err
+	}
+	maskSecrets(keys)
+	return printResource(keyList(keys))
+}
+
+// addKey creates a key with the admin API, the go-ceph CreateKey is only
+// available in ceph_preview builds. It returns the new key.
+func addKey(key UserKeySpec) (UserKeySpec, error) {
+	before, err := getKeys(key.User)
+	if err != nil {
+		return UserKeySpec{}, err
+	}
+
+	args := url.Values{}
+	args.Set("uid", key.User)
+	args.Set("key-type", "s3")
+	if key.AccessKey != "" {
+		args.Set("access-key", key.AccessKey)
+	}
+	if key.SecretKey != "" {
+		args.Set("secret-key", key.SecretKey)
+	}
+	if key.AccessKey == "" || key.SecretKey == "" {
+		args.Set("generate-key", "true")
+	}
+
+	body, err := adminCall(context.Background(), http.MethodPut, "/user?key", args)
+	if err != nil {
+		return UserKeySpec{}, err
+	}
+	var after []UserKeySpec
+	if err := json.Unmarshal(body, &after); err != nil {
+		return UserKeySpec{}, err
+	}
+
+	existing := map[string]bool{}
+	for _, k := range before {
+		existing[k.AccessKey] = true
+	}
+	for _, k := range after {
+		if k.AccessKey == key.AccessKey || (key.AccessKey == "" && !existing[k.AccessKey]) {
+			return k, nil
+		}
+	}
+	return UserKeySpec{}, errKeyNotCreated
+}
+
+func createKey(key UserKeySpec) error {
+	secrets, err := openSecretOutput()
+	if err != nil {
+		return err
+	}
+	defer secrets.discard()
+
+	k, err := addKey(key)
+	if err != nil {
+		return err
+	}
+	return printNewKey(secrets, k)
+}
+
+func printNewKey(secrets *secretOutput, k UserKeySpec) error {
+	if secrets != nil && secrets.save(k.User, k) {
+		return nil
+	}
+	keys := []UserKeySpec{k}
+	maskSecrets(keys)
+	return printResource(keyList(keys))
+}
+
+// deleteKey removes a key with the admin API, the go-ceph RemoveKey is only
+// available in ceph_preview builds.
+func deleteKey(uid, accessKey string) error {
+	args := url.Values{}
+	args.Set("uid", uid)
+	args.Set("key-type", "s3")
+	args.Set("access-key", accessKey)
+	_, err := adminCall(context.Background(), http.MethodDelete, "/user?key", args)
+	return err
+}
+
+func removeKey(uid, accessKey string) error {
+	if err := deleteKey(uid, accessKey); err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Printf("Removed key %s of user %s\n", accessKey, uid)
+	}
+	return nil
+}
+
+func rotateKey(uid, accessKey string) error {
+	secrets, err := openSecretOutput()
+	if err != nil {
+		return err
+	}
+	defer secrets.discard()
+
+	keys, err := getKeys(uid)
+	if err != nil {
+		return err
+	}
+	if accessKey == "" {
+		if len(keys) != 1 {
+			return fmt.Errorf("%w: user %s has %d keys", errAmbiguousKey, uid, len(keys))
+		}
+		accessKey = keys[0].AccessKey
+	}
+	found := false
+	for _, k := range keys {
+		found = found || k.AccessKey == accessKey
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errKeyNotFound, accessKey)
+	}
+
+	k, err := addKey(UserKeySpec{User: uid})
+	if err != nil {
+		return err
+	}
+	if err := printNewKey(secrets, k); err != nil {
+		return err
+	}
+
+	if keyVerify {
+		if err := verifyKey(k); err != nil {
+			return fmt.Errorf("new key %s failed verification, old key %s kept: %w", k.AccessKey, accessKey, err)
+		}
+		fmt.Fprintf(os.Stderr, "New key %s verified\n", k.AccessKey)
+	}
+
+	switch {
+	case keyGrace > 0:
+		fmt.Fprintf(os.Stderr, "Removing old key %s in %s\n", accessKey, keyGrace)
+		time.Sleep(keyGrace)
+	case !assumeYes:
+		if !confirm(fmt.Sprintf("Remove old key %s?", accessKey)) {
+			fmt.Fprintf(os.Stderr, "Old key %s kept\n", accessKey)
+			return nil
+		}
+	}
+
+	if err := deleteKey(uid, accessKey); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Removed old key %s\n", accessKey)
+	return nil
+}
+
+// verifyKey lists the buckets of the key owner on the S3 endpoint. New keys
+// can take a moment to be usable, so it is retried a few times.
+func verifyKey(k UserKeySpec) error {
+	client, err := newS3Client(cephHost, k.AccessKey, k.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err = client.ListBucketsWithContext(context.Background(), nil)
+		if err == nil || attempt == 5 {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+type keyList []UserKeySpec
+
+func (l keyList) table() table {
+	t := table{headers: []string{"User", "Access Key", "Secret Key"}}
+	for _, k := range l {
+		t.rows = append(t.rows, []string{k.User, k.AccessKey, k.SecretKey})
+	}
+	return t
+}
+
+func (l keyList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, k := range l {
+		names = append(names, k.AccessKey)
+	}
+	return names
+}
@@ -0,0 +1,659 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest kinds
+const (
+	kindUser        = "User"
+	kindUserCaps    = "UserCaps"
+	kindUserQuota   = "UserQuota"
+	kindBucketQuota = "BucketQuota"
+	kindBucket      = "Bucket"
+)
+
+// manifestObject is one document of a manifest. Only the fields set in the
+// manifest are managed, current returns the live state of the same fields.
+type manifestObject interface {
+	// ref names the object, e.g. User/alice
+	ref() string
+	// current returns the live state, nil when the object does not exist
+	current(c *admin.API) (manifestObject, error)
+	// apply changes the cluster from the current state to the manifest
+	apply(c *admin.API, current manifestObject) error
+}
+
+// quotaManifest is a user or bucket quota, MaxSize accepts units like 500G
+type quotaManifest struct {
+	Enabled    *bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	MaxSize    *string `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+	MaxObjects *int64  `json:"maxObjects,omitempty" yaml:"maxObjects,omitempty"`
+}
+
+type userManifest struct {
+	Kind        string         `json:"kind" yaml:"kind"`
+	UID         string         `json:"uid" yaml:"uid"`
+	DisplayName string         `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Email       *string        `json:"email,omitempty" yaml:"email,omitempty"`
+	MaxBuckets  *int           `json:"maxBuckets,omitempty" yaml:"maxBuckets,omitempty"`
+	Suspended   *bool          `json:"suspended,omitempty" yaml:"suspended,omitempty"`
+	Caps        []string       `json:"caps,omitempty" yaml:"caps,omitempty"`
+	Quota       *quotaManifest `json:"quota,omitempty" yaml:"quota,omitempty"`
+	BucketQuota *quotaManifest `json:"bucketQuota,omitempty" yaml:"bucketQuota,omitempty"`
+}
+
+// userCapsManifest is the complete list of caps of a user
+type userCapsManifest struct {
+	Kind string   `json:"kind" yaml:"kind"`
+	UID  string   `json:"uid" yaml:"uid"`
+	Caps []string `json:"caps" yaml:"caps"`
+}
+
+type userQuotaManifest struct {
+	Kind          string `json:"kind" yaml:"kind"`
+	UID           string `json:"uid" yaml:"uid"`
+	quotaManifest `yaml:",inline"`
+}
+
+// bucketQuotaManifest is the quota of a bucket, or the default bucket quota
+// of a user when UID is set.
+type bucketQuotaManifest struct {
+	Kind          string `json:"kind" yaml:"kind"`
+	Bucket        string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	UID           string `json:"uid,omitempty" yaml:"uid,omitempty"`
+	quotaManifest `yaml:",inline"`
+}
+
+// bucketManifest is the owner of an existing bucket
+type bucketManifest struct {
+	Kind   string `json:"kind" yaml:"kind"`
+	Bucket string `json:"bucket" yaml:"bucket"`
+	Owner  string `json:"owner" yaml:"owner"`
+}
+
+// kindOrder is the order manifests are applied in, users before the objects
+// that refer to them.
+var kindOrder = map[string]int{kindUser: 0, kindUserCaps: 1, kindUserQuota: 2, kindBucket: 3, kindBucketQuota: 4}
+
+// sortManifests sorts manifests by kind, keeping the file order per kind.
+func sortManifests(objects []manifestObject) {
+	kind := func(o manifestObject) string {
+		k, _, _ := strings.Cut(o.ref(), "/")
+		return k
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindOrder[kind(objects[i])] < kindOrder[kind(objects[j])]
+	})
+}
+
+// readManifests reads the manifests of files, directories of *.yaml and
+// *.yml files, or stdin for "-". Files may hold several documents.
+func readManifests(paths []string) ([]manifestObject, error) {
+	var objects []manifestObject
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files = nil
+			err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if ext := filepath.Ext(p); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+					files = append(files, p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, file := range files {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return nil, err
+			}
+			o, err := decodeManifests(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			objects = append(objects, o...)
+		}
+	}
+	return objects, nil
+}
+
+func decodeManifests(data []byte) ([]manifestObject, error) {
+	var objects []manifestObject
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := d.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		var header struct {
+			Kind string `yaml:"kind"`
+		}
+		if err := doc.Decode(&header); err != nil {
+			return nil, err
+		}
+		var o manifestObject
+		switch header.Kind {
+		case kindUser:
+			o = &userManifest{}
+		case kindUserCaps:
+			o = &userCapsManifest{}
+		case kindUserQuota:
+			o = &userQuotaManifest{}
+		case kindBucketQuota:
+			o = &bucketQuotaManifest{}
+		case kindBucket:
+			o = &bucketManifest{}
+		default:
+			return nil, fmt.Errorf("line %d: %w: %q", doc.Line, errUnknownKind, header.Kind)
+		}
+
+		// decode again to reject unknown fields
+		raw, err := yaml.Marshal(&doc)
+		if err != nil {
+			return nil, err
+		}
+		strict := yaml.NewDecoder(bytes.NewReader(raw))
+		strict.KnownFields(true)
+		if err := strict.Decode(o); err != nil {
+			return nil, fmt.Errorf("line %d: %w", doc.Line, err)
+		}
+		if err := normalizeManifest(o); err != nil {
+			return nil, fmt.Errorf("line %d: %w", doc.Line, err)
+		}
+		objects = append(objects, o)
+	}
+}
+
+// normalizeManifest checks required fields and brings caps and sizes to the
+// form current returns them in.
+func normalizeManifest(o manifestObject) error {
+	var err error
+	switch o := o.(type) {
+	case *userManifest:
+		if o.UID == "" {
+			return fmt.Errorf("%w: uid is required", errInvalidManifest)
+		}
+		if o.Caps, err = normalizeCaps(o.Caps); err != nil {
+			return err
+		}
+		if err := o.Quota.normalize(); err != nil {
+			return err
+		}
+		return o.BucketQuota.normalize()
+	case *userCapsManifest:
+		if o.UID == "" {
+			return fmt.Errorf("%w: uid is required", errInvalidManifest)
+		}
+		o.Caps, err = normalizeCaps(o.Caps)
+		return err
+	case *userQuotaManifest:
+		if o.UID == "" {
+			return fmt.Errorf("%w: uid is required", errInvalidManifest)
+		}
+		return o.quotaManifest.normalize()
+	case *bucketQuotaManifest:
+		if (o.Bucket == "") == (o.UID == "") {
+			return fmt.Errorf("%w: one of bucket or uid is required", errInvalidManifest)
+		}
+		return o.quotaManifest.normalize()
+	case *bucketManifest:
+		if o.Bucket == "" || o.Owner == "" {
+			return fmt.Errorf("%w: bucket and owner are required", errInvalidManifest)
+		}
+	}
+	return nil
+}
+
+func (q *quotaManifest) normalize() error {
+	if q == nil || q.MaxSize == nil {
+		return nil
+	}
+	size, err := parseSize(*q.MaxSize)
+	if err != nil {
+		return err
+	}
+	s := formatSizeExact(size)
+	q.MaxSize = &s
+	return nil
+}
+
+// managed returns the live quota limited to the fields set in q.
+func (q *quotaManifest) managed(live QuotaSpec) *quotaManifest {
+	if q == nil {
+		return nil
+	}
+	m := &quotaManifest{}
+	if q.Enabled != nil {
+		enabled := live.Enabled != nil && *live.Enabled
+		m.Enabled = &enabled
+	}
+	if q.MaxSize != nil {
+		size := int64(-1)
+		if live.MaxSize != nil {
+			size = *live.MaxSize
+		}
+		if size < 0 {
+			size = -1
+		}
+		s := formatSizeExact(size)
+		m.MaxSize = &s
+	}
+	if q.MaxObjects != nil {
+		objects := int64(-1)
+		if live.MaxObjects != nil && *live.MaxObjects >= 0 {
+			objects = *live.MaxObjects
+		}
+		m.MaxObjects = &objects
+	}
+	return m
+}
+
+func (q *quotaManifest) spec() admin.QuotaSpec {
+	spec := admin.QuotaSpec{Enabled: q.Enabled, MaxObjects: q.MaxObjects}
+	if q.MaxSize != nil {
+		// validated by normalize
+		size, _ := parseSize(*q.MaxSize)
+		spec.MaxSize = &size
+	}
+	return spec
+}
+
+// normalizeCaps returns sorted caps in type=perm form, perm being read,
+// write or * for read and write.
+func normalizeCaps(caps []string) ([]string, error) {
+	if caps == nil {
+		return nil, nil
+	}
+	normalized := []string{}
+	for _, c := range caps {
+		for _, c := range strings.Split(c, ";") {
+			capType, perm, found := strings.Cut(c, "=")
+			capType = strings.TrimSpace(capType)
+			if !found || capType == "" {
+				return nil, fmt.Errorf("%w: %q", errInvalidCaps, c)
+			}
+			perm, err := normalizePerm(perm)
+			if err != nil {
+				return nil, err
+			}
+			normalized = append(normalized, capType+"="+perm)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func normalizePerm(perm string) (string, error) {
+	read, write := false, false
+	for _, p := range strings.Split(perm, ",") {
+		switch strings.TrimSpace(p) {
+		case "read":
+			read = true
+		case "write":
+			write = true
+		case "*":
+			read, write = true, true
+		default:
+			return "", fmt.Errorf("%w: %q", errInvalidCaps, perm)
+		}
+	}
+	switch {
+	case read && write:
+		return "*", nil
+	case read:
+		return "read", nil
+	}
+	return "write", nil
+}
+
+// updateCaps removes the caps that are not desired and adds the missing ones.
+// Changed permissions are removed first, as RGW merges added permissions.
+func updateCaps(c *admin.API, uid string, desired, live []string) error {
+	want := map[string]bool{}
+	for _, cap := range desired {
+		want[cap] = true
+	}
+	have := map[string]bool{}
+	for _, cap := range live {
+		have[cap] = true
+		if !want[cap] {
+			if _, err := c.RemoveUserCap(context.Background(), uid, cap); err != nil {
+				return err
+			}
+		}
+	}
+	for _, cap := range desired {
+		if !have[cap] {
+			if _, err := c.AddUserCap(context.Background(), uid, cap); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getManagedUser returns the user, nil when it does not exist.
+func getManagedUser(c *admin.API, uid string) (*User, error) {
+	u, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if errors.Is(err, admin.ErrNoSuchUser) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	if err := remarshal(u, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (m *userManifest) ref() string { return kindUser + "/" + m.UID }
+
+func (m *userManifest) current(c *admin.API) (manifestObject, error) {
+	u, err := getManagedUser(c, m.UID)
+	if u == nil || err != nil {
+		return nil, err
+	}
+
+	live := &userManifest{Kind: m.Kind, UID: u.ID}
+	if m.DisplayName != "" {
+		live.DisplayName = u.DisplayName
+	}
+	if m.Email != nil {
+		live.Email = &u.Email
+	}
+	if m.MaxBuckets != nil {
+		live.MaxBuckets = u.MaxBuckets
+	}
+	if m.Suspended != nil {
+		suspended := u.Suspended != nil && *u.Suspended != 0
+		live.Suspended = &suspended
+	}
+	if m.Caps != nil {
+		live.Caps = []string{}
+		for _, c := range u.Caps {
+			live.Caps = append(live.Caps, c.Type+"="+c.Perm)
+		}
+		if live.Caps, err = normalizeCaps(live.Caps); err != nil {
+			return nil, err
+		}
+	}
+	live.Quota = m.Quota.managed(u.UserQuota)
+	live.BucketQuota = m.BucketQuota.managed(u.BucketQuota)
+	return live, nil
+}
+
+func (m *userManifest) apply(c *admin.API, current manifestObject) error {
+	live, _ := current.(*userManifest)
+	if live == nil {
+		user := admin.User{ID: m.UID, DisplayName: m.DisplayName, MaxBuckets: m.MaxBuckets}
+		if user.DisplayName == "" {
+			user.DisplayName = m.UID
+		}
+		if m.Email != nil {
+			user.Email = *m.Email
+		}
+		if m.Suspended != nil && *m.Suspended {
+			suspended := 1
+			user.Suspended = &suspended
+		}
+		if _, err := c.CreateUser(context.Background(), user); err != nil {
+			return err
+		}
+		live = &userManifest{}
+	} else if m.DisplayName != live.DisplayName || !reflect.DeepEqual(m.Email, live.Email) ||
+		!reflect.DeepEqual(m.MaxBuckets, live.MaxBuckets) || !reflect.DeepEqual(m.Suspended, live.Suspended) {
+		user := admin.User{ID: m.UID, DisplayName: m.DisplayName, MaxBuckets: m.MaxBuckets}
+		if m.Email != nil {
+			user.Email = *m.Email
+		}
+		if m.Suspended != nil {
+			suspended := 0
+			if *m.Suspended {
+				suspended = 1
+			}
+			user.Suspended = &suspended
+		}
+		if _, err := c.ModifyUser(context.Background(), user); err != nil {
+			return err
+		}
+	}
+
+	if m.Caps != nil && !reflect.DeepEqual(m.Caps, live.Caps) {
+		if err := updateCaps(c, m.UID, m.Caps, live.Caps); err != nil {
+			return err
+		}
+	}
+	if m.Quota != nil && !reflect.DeepEqual(m.Quota, live.Quota) {
+		quota := m.Quota.spec()
+		quota.UID = m.UID
+		if err := c.SetUserQuota(context.Background(), quota); err != nil {
+			return err
+		}
+	}
+	if m.BucketQuota != nil && !reflect.DeepEqual(m.BucketQuota, live.BucketQuota) {
+		if err := putBucketQuota("", m.UID, m.BucketQuota.spec()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *userCapsManifest) ref() string { return kindUserCaps + "/" + m.UID }
+
+func (m *userCapsManifest) current(c *admin.API) (manifestObject, error) {
+	u, err := getManagedUser(c, m.UID)
+	if u == nil || err != nil {
+		return nil, err
+	}
+	live := &userCapsManifest{Kind: m.Kind, UID: u.ID, Caps: []string{}}
+	for _, c := range u.Caps {
+		live.Caps = append(live.Caps, c.Type+"="+c.Perm)
+	}
+	live.Caps, err = normalizeCaps(live.Caps)
+	return live, err
+}
+
+func (m *userCapsManifest) apply(c *admin.API, current manifestObject) error {
+	live, _ := current.(*userCapsManifest)
+	if live == nil {
+		return fmt.Errorf("%w: %s", admin.ErrNoSuchUser, m.UID)
+	}
+	return updateCaps(c, m.UID, m.Caps, live.Caps)
+}
+
+func (m *userQuotaManifest) ref() string { return kindUserQuota + "/" + m.UID }
+
+func (m *userQuotaManifest) current(c *admin.API) (manifestObject, error) {
+	u, err := getManagedUser(c, m.UID)
+	if u == nil || err != nil {
+		return nil, err
+	}
+	return &userQuotaManifest{Kind: m.Kind, UID: u.ID, quotaManifest: *m.quotaManifest.managed(u.UserQuota)}, nil
+}
+
+func (m *userQuotaManifest) apply(c *admin.API, current manifestObject) error {
+	if current == nil {
+		return fmt.Errorf("%w: %s", admin.ErrNoSuchUser, m.UID)
+	}
+	quota := m.spec()
+	quota.UID = m.UID
+	return c.SetUserQuota(context.Background(), quota)
+}
+
+func (m *bucketQuotaManifest) ref() string {
+	if m.UID != "" {
+		return kindBucketQuota + "/" + m.UID
+	}
+	return kindBucketQuota + "/" + m.Bucket
+}
+
+func (m *bucketQuotaManifest) current(c *admin.API) (manifestObject, error) {
+	live := &bucketQuotaManifest{Kind: m.Kind, Bucket: m.Bucket, UID: m.UID}
+	if m.UID != "" {
+		u, err := getManagedUser(c, m.UID)
+		if u == nil || err != nil {
+			return nil, err
+		}
+		live.quotaManifest = *m.quotaManifest.managed(u.BucketQuota)
+		return live, nil
+	}
+
+	b, err := getBucket(m.Bucket)
+	if errors.Is(err, admin.ErrNoSuchBucket) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	live.quotaManifest = *m.quotaManifest.managed(b.BucketQuota)
+	return live, nil
+}
+
+func (m *bucketQuotaManifest) apply(c *admin.API, current manifestObject) error {
+	if current == nil {
+		if m.UID != "" {
+			return fmt.Errorf("%w: %s", admin.ErrNoSuchUser, m.UID)
+		}
+		return fmt.Errorf("%w: %s", admin.ErrNoSuchBucket, m.Bucket)
+	}
+	return putBucketQuota(m.Bucket, m.UID, m.spec())
+}
+
+func (m *bucketManifest) ref() string { return kindBucket + "/" + m.Bucket }
+
+func (m *bucketManifest) current(c *admin.API) (manifestObject, error) {
+	b, err := getBucket(m.Bucket)
+	if errors.Is(err, admin.ErrNoSuchBucket) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bucketManifest{Kind: m.Kind, Bucket: b.Bucket, Owner: b.Owner}, nil
+}
+
+func (m *bucketManifest) apply(c *admin.API, current manifestObject) error {
+	if current == nil {
+		// buckets are created through S3, not the admin API
+		return fmt.Errorf("%w: %s", admin.ErrNoSuchBucket, m.Bucket)
+	}
+	b, err := getBucket(m.Bucket)
+	if err != nil {
+		return err
+	}
+	return c.LinkBucket(context.Background(), admin.BucketLinkInput{Bucket: b.Bucket, BucketID: b.ID, UID: m.Owner})
+}
+
+// manifestKeys are the fields naming the object
+var manifestKeys = map[string]bool{"kind": true, "uid": true, "bucket": true}
+
+// manifestChanges lists the fields that differ between the current state and
+// the manifest, e.g. "email: a@example.com -> b@example.com".
+func manifestChanges(desired, current manifestObject) []string {
+	want := flattenManifest(desired)
+	have := map[string]string{}
+	if current != nil && !reflect.ValueOf(current).IsNil() {
+		have = flattenManifest(current)
+	}
+
+	var changes []string
+	for field, value := range want {
+		if manifestKeys[field] {
+			continue
+		}
+		if before, ok := have[field]; !ok || before != value {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", field, formatChangeValue(before), formatChangeValue(value)))
+		}
+	}
+	for field, before := range have {
+		if _, ok := want[field]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", field, formatChangeValue(before), formatChangeValue("")))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// flattenManifest flattens the manifest fields like flattenResource, but keeps
+// lists like caps as one value.
+func flattenManifest(o manifestObject) map[string]string {
+	fields := map[string]string{}
+	var data map[string]interface{}
+	if err := remarshal(o, &data); err != nil {
+		return fields
+	}
+	for k, v := range data {
+		if list, ok := v.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			data[k] = strings.Join(items, ", ")
+		}
+	}
+	flattenValue("", data, fields)
+	return fields
+}
+
+func formatChangeValue(v string) string {
+	if v == "" {
+		return "<none>"
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestChanges(t *testing.T) {
+	int64p := func(v int64) *int64 { return &v }
+	intp := func(v int) *int { return &v }
+	stringp := func(v string) *string { return &v }
+
+	desired := &userManifest{
+		Kind:       kindUser,
+		UID:        "alice",
+		MaxBuckets: intp(1000000),
+		Quota:      &quotaManifest{MaxSize: stringp("1000000000"), MaxObjects: int64p(25000000)},
+	}
+	if err := desired.Quota.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	current := &userManifest{
+		Kind:       kindUser,
+		UID:        "alice",
+		MaxBuckets: intp(1000),
+		Quota:      desired.Quota.managed(QuotaSpec{}),
+	}
+
+	tests := []struct {
+		name    string
+		current manifestObject
+		want    []string
+	}{
+		{
+			name:    "create",
+			current: (*userManifest)(nil),
+			want: []string{
+				"maxBuckets: <none> -> 1000000",
+				"quota.maxObjects: <none> -> 25000000",
+				"quota.maxSize: <none> -> 1000000000",
+			},
+		},
+		{
+			name:    "update",
+			current: current,
+			want: []string{
+				"maxBuckets: 1000 -> 1000000",
+				"quota.maxObjects: -1 -> 25000000",
+				"quota.maxSize: -1 -> 1000000000",
+			},
+		},
+		{
+			name:    "unchanged",
+			current: desired,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := manifestChanges(desired, tt.current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: manifestChanges() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
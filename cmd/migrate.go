@@ -0,0 +1,225 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate between clusters",
+		Long:  `Migrate between configured clusters`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	migrateUsersCmd = &cobra.Command{
+		Use:   "users",
+		Short: "Copy users to another cluster",
+		Long: `Copy users with display name, email, caps, subusers and quotas from one
+configured cluster to another. Users get new keys on the target cluster,
+unless --keep-keys is given, which copies the exact access and secret keys
+so that applications keep working.
+
+New keys are listed after the users, secret keys are not shown unless
+--show-secrets is given. Save them to a file with --secret-output-file and
+--secret-format, each user is a profile of the file.
+
+Without --user all users are copied, except the admin users of the --from
+and --to profiles, which would clash on the target cluster.
+
+Buckets and their data are not copied, see bucket sync.
+
+cephmgr migrate users --from staging --to prod --user alice --user bob --keep-keys
+
+Existing users on the target cluster are handled with --on-conflict as in import.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := migrateUsers(migrateFrom, migrateTo)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUsersCmd)
+
+	migrateUsersCmd.Flags().StringVar(&migrateFrom, "from", "", "Source cluster")
+	migrateUsersCmd.Flags().StringVar(&migrateTo, "to", "", "Target cluster")
+	migrateUsersCmd.Flags().StringSliceVarP(&migrateUIDs, "user", "u", nil, "Copy only these users (default all)")
+	migrateUsersCmd.Flags().BoolVar(&migrateKeepKeys, "keep-keys", false, "Copy access and secret keys")
+	migrateUsersCmd.Flags().StringVar(&onConflict, "on-conflict", conflictFail, "Existing users: skip|overwrite|fail")
+	migrateUsersCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be copied")
+	migrateUsersCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Show new secret keys in output")
+	migrateUsersCmd.Flags().StringVar(&secretOutputFile, "secret-output-file", "", "Write new credentials to file (created with 0600 permissions)")
+	migrateUsersCmd.Flags().StringVar(&secretFormat, "secret-format", "", "Credentials format: env|aws-credentials|s3cfg|rclone (default env)")
+	migrateUsersCmd.MarkFlagRequired("from")
+	migrateUsersCmd.MarkFlagRequired("to")
+}
+
+func migrateUsers(from, to string) error {
+	switch onConflict {
+	case conflictSkip, conflictOverwrite, conflictFail:
+	default:
+		return fmt.Errorf("%w: %s", errUnknownConflict, onConflict)
+	}
+	source, err := resolveCluster(from)
+	if err != nil {
+		return err
+	}
+	target, err := resolveCluster(to)
+	if err != nil {
+		return err
+	}
+	if source.Hostname == target.Hostname {
+		return fmt.Errorf("%w: %s", errSameCluster, source.Hostname)
+	}
+
+	var secrets *secretOutput
+	if !migrateKeepKeys {
+		if secrets, err = openSecretOutput(); err != nil {
+			return err
+		}
+		defer secrets.discard()
+	}
+
+	connectCluster(source)
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+	uids := migrateUIDs
+	if len(uids) == 0 {
+		if uids, err = migrateAllUsers(c, source, target); err != nil {
+			return err
+		}
+	}
+	state, err := exportState(c, uids, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", from, err)
+	}
+	if !migrateKeepKeys {
+		for i := range state.Users {
+			u := &state.Users[i]
+			u.Keys = nil
+			u.SwiftKeys = nil
+			u.generateKey = true
+		}
+	}
+
+	connectCluster(target)
+	c, err = admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+	results, err := importState(c, state, onConflict)
+	if err != nil {
+		return fmt.Errorf("%s: %w", to, err)
+	}
+	if err := printResource(results); err != nil {
+		return err
+	}
+	if !migrateKeepKeys && !dryRun {
+		if err := printMigratedKeys(c, results, secrets); err != nil {
+			return err
+		}
+	}
+	if failed := results.failed(); failed > 0 {
+		return fmt.Errorf("%w: %d of %d users", errBulkFailed, failed, len(results))
+	}
+	return nil
+}
+
+// migrateAllUsers lists the users of the source cluster without the admin
+// users of the source and target profiles.
+func migrateAllUsers(c *admin.API, source, target Cluster) ([]string, error) {
+	all, err := c.GetUsers(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source.Hostname, err)
+	}
+	skip := map[string]bool{}
+	for _, cluster := range []Cluster{source, target} {
+		uid, err := profileUser(cluster)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cluster.Hostname, err)
+		}
+		skip[uid] = true
+	}
+	uids := []string{}
+	for _, uid := range *all {
+		if !skip[uid] {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+// profileUser returns the user owning the access key of the cluster profile.
+func profileUser(cluster Cluster) (string, error) {
+	c, err := admin.New(cluster.Hostname, cluster.AccessKey, cluster.AccessSecret, nil)
+	if err != nil {
+		return "", err
+	}
+	u, err := c.GetUser(context.Background(), admin.User{Keys: []admin.UserKeySpec{{AccessKey: cluster.AccessKey}}})
+	if err != nil {
+		return "", err
+	}
+	return u.ID, nil
+}
+
+// printMigratedKeys saves or prints the keys generated for the created users,
+// as they are not part of the results.
+func printMigratedKeys(c *admin.API, results applyResultList, secrets *secretOutput) error {
+	var keys []UserKeySpec
+	for _, r := range results {
+		if r.Action != "created" {
+			continue
+		}
+		u, err := getManagedUser(c, strings.TrimPrefix(r.Object, kindUser+"/"))
+		if err != nil {
+			return err
+		}
+		if u != nil {
+			keys = append(keys, u.Keys...)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if secrets != nil && secrets.saveAll(keys) {
+		return nil
+	}
+	maskSecrets(keys)
+	return printResource(keyList(keys))
+}
@@ -1,12 +1,22 @@
 package cmd
 
 type User struct {
-	ID          string        `json:"user_id" url:"uid"`
-	DisplayName string        `json:"display_name" url:"display-name"`
-	Email       string        `json:"email" url:"email"`
-	Keys        []UserKeySpec `json:"keys"`
-	Caps        []UserCapSpec `json:"caps"`
-	UserCaps    string        `url:"user-caps"`
+	ID          string         `json:"user_id" url:"uid"`
+	DisplayName string         `json:"display_name" url:"display-name"`
+	Email       string         `json:"email" url:"email"`
+	Suspended   *int           `json:"suspended"`
+	MaxBuckets  *int           `json:"max_buckets"`
+	Subusers    []SubuserSpec  `json:"subusers"`
+	Keys        []UserKeySpec  `json:"keys"`
+	SwiftKeys   []SwiftKeySpec `json:"swift_keys"`
+	Caps        []UserCapSpec  `json:"caps"`
+	UserCaps    string         `json:"-" url:"user-caps"`
+
+	OpMask           string    `json:"op_mask"`
+	DefaultPlacement string    `json:"default_placement"`
+	BucketQuota      QuotaSpec `json:"bucket_quota"`
+	UserQuota        QuotaSpec `json:"user_quota"`
+	Stats            UserStat  `json:"stats"`
 }
 
 type UserKeySpec struct {
@@ -15,13 +25,91 @@ type UserKeySpec struct {
 	SecretKey string `json:"secret_key" url:"secret-key"`
 }
 
+type SubuserSpec struct {
+	ID          string `json:"id"`
+	Permissions string `json:"permissions"`
+}
+
+type SwiftKeySpec struct {
+	User      string `json:"user"`
+	SecretKey string `json:"secret_key"`
+}
+
 type UserCapSpec struct {
 	Type string `json:"type"`
 	Perm string `json:"perm"`
 }
 
+type QuotaSpec struct {
+	Enabled    *bool  `json:"enabled"`
+	CheckOnRaw bool   `json:"check_on_raw"`
+	MaxSize    *int64 `json:"max_size"`
+	MaxObjects *int64 `json:"max_objects"`
+}
+
+type UserStat struct {
+	Size        *uint64 `json:"size"`
+	SizeRounded *uint64 `json:"size_rounded"`
+	NumObjects  *uint64 `json:"num_objects"`
+}
+
 type Bucket struct {
-	ID     string `json:"id"`
-	Bucket string `json:"bucket" url:"bucket"`
-	Owner  string `json:"owner"`
+	ID            string                     `json:"id"`
+	Marker        string                     `json:"marker"`
+	Bucket        string                     `json:"bucket" url:"bucket"`
+	Owner         string                     `json:"owner"`
+	Zonegroup     string                     `json:"zonegroup"`
+	PlacementRule string                     `json:"placement_rule"`
+	IndexType     string                     `json:"index_type"`
+	NumShards     *uint64                    `json:"num_shards"`
+	CreationTime  string                     `json:"creation_time"`
+	Mtime         string                     `json:"mtime"`
+	Versioning    string                     `json:"versioning"`
+	Usage         map[string]BucketUsageSpec `json:"usage"`
+	BucketQuota   QuotaSpec                  `json:"bucket_quota"`
+}
+
+// BucketUsageSpec is the usage of one bucket category, e.g. rgw.main
+type BucketUsageSpec struct {
+	Size         *uint64 `json:"size"`
+	SizeActual   *uint64 `json:"size_actual"`
+	SizeUtilized *uint64 `json:"size_utilized"`
+	NumObjects   *uint64 `json:"num_objects"`
+}
+
+// Usage is the RGW usage log, entries per bucket and hour and a summary per user
+type Usage struct {
+	Entries []UsageEntry   `json:"entries"`
+	Summary []UsageSummary `json:"summary"`
+}
+
+// UsageEntry is the usage of one user
+type UsageEntry struct {
+	User    string             `json:"user"`
+	Buckets []UsageBucketEntry `json:"buckets"`
+}
+
+// UsageBucketEntry is the usage of one bucket in one hour
+type UsageBucketEntry struct {
+	Bucket     string          `json:"bucket"`
+	Time       string          `json:"time"`
+	Epoch      uint64          `json:"epoch"`
+	Owner      string          `json:"owner"`
+	Categories []UsageCategory `json:"categories"`
+}
+
+// UsageSummary is the usage of one user summed over the time range
+type UsageSummary struct {
+	User       string          `json:"user"`
+	Categories []UsageCategory `json:"categories"`
+	Total      UsageCategory   `json:"total"`
+}
+
+// UsageCategory holds the operation and byte counts of one category, e.g. get_obj
+type UsageCategory struct {
+	Category      string `json:"category,omitempty"`
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successful_ops"`
 }
@@ -0,0 +1,212 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// modifyCmd represents the modify command
+var (
+	modifyCmd = &cobra.Command{
+		Use:   "modify",
+		Short: "Modify user",
+		Long: `Modify user display name, email, max buckets, suspended flag,
+op mask or default placement. Only the given flags are changed, a flag
+with an empty value clears the field:
+
+cephmgr rgw user modify --user alice --max-buckets 100 --op-mask "read, write"
+
+cephmgr rgw user modify --user alice --email ""
+
+The changed fields are shown before and after the modification.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+
+			// flags given with an empty value clear the field, e.g. --email ""
+			params := url.Values{}
+			for flag, param := range map[string]string{
+				"fullname":          "display-name",
+				"email":             "email",
+				"max-buckets":       "max-buckets",
+				"suspended":         "suspended",
+				"op-mask":           "op-mask",
+				"default-placement": "default-placement",
+			} {
+				if f := cmd.Flags().Lookup(flag); f.Changed {
+					params.Set(param, f.Value.String())
+				}
+			}
+			if cmd.Flags().Changed("suspended") {
+				// the admin API takes the flag as a number
+				params.Set("suspended", "0")
+				if userSuspended {
+					params.Set("suspended", "1")
+				}
+			}
+
+			err := modifyUser(userName, params)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	userCmd.AddCommand(modifyCmd)
+
+	modifyCmd.Flags().StringVarP(&userFullname, "fullname", "f", "", "User display name")
+	modifyCmd.Flags().StringVarP(&userEmail, "email", "e", "", "User email")
+	modifyCmd.Flags().IntVar(&userMaxBuckets, "max-buckets", 0, "Maximum number of buckets")
+	modifyCmd.Flags().BoolVar(&userSuspended, "suspended", false, "Suspend user")
+	modifyCmd.Flags().StringVar(&userOpMask, "op-mask", "", "Allowed operations, e.g. \"read, write, delete\"")
+	modifyCmd.Flags().StringVar(&userDefaultPlacement, "default-placement", "", "Default placement target")
+
+	modifyCmd.MarkFlagRequired("user")
+}
+
+// modifyUser changes the fields of args with the admin API. go-ceph's
+// ModifyUser does not send empty values, op-mask and default-placement.
+func modifyUser(uid string, args url.Values) error {
+	if len(args) == 0 {
+		return errNothingToModify
+	}
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	before, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if err != nil {
+		return err
+	}
+
+	args.Set("uid", uid)
+	if _, err := adminCall(context.Background(), http.MethodPost, "/user", args); err != nil {
+		return err
+	}
+
+	after, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if err != nil {
+		return err
+	}
+
+	diff := userDiff{}
+	if err := remarshal(before, &diff.Before); err != nil {
+		return err
+	}
+	if err := remarshal(after, &diff.After); err != nil {
+		return err
+	}
+	maskUserSecrets(&diff.Before)
+	maskUserSecrets(&diff.After)
+	return printResource(diff)
+}
+
+// userDiff is a user before and after a modification.
+type userDiff struct {
+	Before User `json:"before"`
+	After  User `json:"after"`
+}
+
+func (d userDiff) table() table {
+	before := map[string]string{}
+	after := map[string]string{}
+	flattenResource(d.Before, before)
+	flattenResource(d.After, after)
+
+	fields := map[string]bool{}
+	for f := range before {
+		fields[f] = true
+	}
+	for f := range after {
+		fields[f] = true
+	}
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		if before[f] != after[f] {
+			names = append(names, f)
+		}
+	}
+	sort.Strings(names)
+
+	t := table{headers: []string{"Field", "Before", "After"}}
+	for _, f := range names {
+		t.rows = append(t.rows, []string{f, before[f], after[f]})
+	}
+	return t
+}
+
+func (d userDiff) names() []string {
+	return []string{d.After.ID}
+}
+
+// flattenResource stores the JSON fields of v into fields, keyed by their
+// dotted path, e.g. "keys.0.access_key".
+func flattenResource(v interface{}, fields map[string]string) {
+	var data interface{}
+	if err := remarshal(v, &data); err != nil {
+		return
+	}
+	flattenValue("", data, fields)
+}
+
+func flattenValue(prefix string, v interface{}, fields map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			flattenValue(join(k), child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(join(strconv.Itoa(i)), child, fields)
+		}
+	case nil:
+		fields[prefix] = ""
+	case float64:
+		// JSON numbers decode as float64, print them without exponent
+		fields[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		fields[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputWide  = "wide"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputName  = "name"
+	outputCSV   = "csv"
+	outputMD    = "markdown"
+
+	outputGoTemplate = "go-template"
+	outputJSONPath   = "jsonpath"
+)
+
+// resource is a command result printable in every output format. JSON and
+// YAML output encode the resource itself.
+type resource interface {
+	table() table
+	names() []string
+}
+
+// table is the human readable form of a resource.
+type table struct {
+	headers []string
+	rows    [][]string
+	// wide is the number of trailing columns shown only with -o wide
+	wide int
+}
+
+func humanOutput() bool {
+	return outputFormat == outputTable || outputFormat == outputWide
+}
+
+func printResource(r resource) error {
+	format, arg, _ := strings.Cut(outputFormat, "=")
+	switch format {
+	case outputTable, outputWide:
+		return printTable(r.table())
+	case outputCSV:
+		return printCSV(r.table())
+	case outputMD:
+		return printMarkdown(r.table())
+	case outputJSON:
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case outputYAML:
+		// encode through JSON so YAML has the same field names
+		v, err := genericValue(r)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case outputName:
+		for _, name := range r.names() {
+			fmt.Println(name)
+		}
+	case outputGoTemplate:
+		// templates see the Go values, e.g. {{.ID}} or {{range .Keys}}
+		tmpl, err := template.New("output").Parse(arg)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(os.Stdout, r)
+	case outputJSONPath:
+		// JSONPath uses the JSON field names, e.g. {.keys[*].access_key}
+		jp, err := parseJSONPath(arg)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := remarshal(r, &v); err != nil {
+			return err
+		}
+		return jp.execute(os.Stdout, v)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownOutputFormat, outputFormat)
+	}
+	return nil
+}
+
+// printCSV prints the table with all wide columns as CSV.
+func printCSV(t table) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(t.headers); err != nil {
+		return err
+	}
+	if err := w.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// printMarkdown prints the table with all wide columns as a Markdown table.
+func printMarkdown(t table) error {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	line := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, c := range cells {
+			escaped[i] = escape.Replace(c)
+		}
+		fmt.Printf("| %s |\n", strings.Join(escaped, " | "))
+	}
+
+	line(t.headers)
+	separator := make([]string, len(t.headers))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	line(separator)
+	for _, row := range t.rows {
+		line(row)
+	}
+	return nil
+}
+
+func printTable(t table) error {
+	columns := len(t.headers)
+	if outputFormat != outputWide {
+		columns -= t.wide
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 5, ' ', 0)
+	fmt.Fprintln(w, strings.Join(t.headers[:columns], "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row[:columns], "\t"))
+	}
+	return w.Flush()
+}
+
+// genericValue returns the JSON form of v as maps and slices. Integers are
+// kept as int64, so large sizes are not printed in exponent notation.
+func genericValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var out interface{}
+	if err := d.Decode(&out); err != nil {
+		return nil, err
+	}
+	return convertNumbers(out), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// remarshal converts between types sharing JSON field names, e.g. from the
+// go-ceph admin types to the cephmgr models.
+func remarshal(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// quotaCmd represents the quota command
+var (
+	quotaCmd = &cobra.Command{
+		Use:   "quota",
+		Short: "User quota operations",
+		Long:  `Get and set user quota`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	getQuotaCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Get user quota",
+		Long:  `Get user quota with current usage`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := getUserQuota(userName)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	setQuotaCmd = &cobra.Command{
+		Use:   "set",
+		Short: "Set user quota",
+		Long: `Set user quota limits. Sizes accept units like 500G or 1.5T,
+-1 removes the limit:
+
+cephmgr rgw user quota set --user alice --max-size 500G --max-objects 1000000
+
+The quota is enforced only after it is enabled.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			quota, err := quotaFromFlags(cmd)
+			if err == nil {
+				quota.UID = userName
+				err = setUserQuota(quota)
+			}
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	enableQuotaCmd = &cobra.Command{
+		Use:   "enable",
+		Short: "Enable user quota",
+		Long:  `Enable user quota`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			enabled := true
+			err := setUserQuota(admin.QuotaSpec{UID: userName, Enabled: &enabled})
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	disableQuotaCmd = &cobra.Command{
+		Use:   "disable",
+		Short: "Disable user quota",
+		Long:  `Disable user quota`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			enabled := false
+			err := setUserQuota(admin.QuotaSpec{UID: userName, Enabled: &enabled})
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	userCmd.AddCommand(quotaCmd)
+	quotaCmd.AddCommand(getQuotaCmd)
+	quotaCmd.AddCommand(setQuotaCmd)
+	quotaCmd.AddCommand(enableQuotaCmd)
+	quotaCmd.AddCommand(disableQuotaCmd)
+
+	setQuotaCmd.Flags().StringVar(&quotaMaxSize, "max-size", "", "Maximum size, e.g. 500G, -1 for unlimited")
+	setQuotaCmd.Flags().Int64Var(&quotaMaxObjects, "max-objects", 0, "Maximum number of objects, -1 for unlimited")
+}
+
+// quotaFromFlags returns the limits given with --max-size and --max-objects,
+// and the quota state given with --enable on commands which have it.
+func quotaFromFlags(cmd *cobra.Command) (admin.QuotaSpec, error) {
+	quota := admin.QuotaSpec{}
+	if cmd.Flags().Changed("max-size") {
+		size, err := parseSize(quotaMaxSize)
+		if err != nil {
+			return quota, err
+		}
+		quota.MaxSize = &size
+	}
+	if cmd.Flags().Changed("max-objects") {
+		quota.MaxObjects = &quotaMaxObjects
+	}
+	if f := cmd.Flags().Lookup("enable"); f != nil && f.Changed {
+		quota.Enabled = &quotaEnable
+	}
+	if quota.MaxSize == nil && quota.MaxObjects == nil && quota.Enabled == nil {
+		return quota, errNothingToModify
+	}
+	return quota, nil
+}
+
+func getUserQuota(uid string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	stats := true
+	u, err := c.GetUser(context.Background(), admin.User{ID: uid, GenerateStat: &stats})
+	if err != nil {
+		return err
+	}
+
+	info := quotaInfo{UID: uid}
+	if err := remarshal(u.UserQuota, &info.Quota); err != nil {
+		return err
+	}
+	if err := remarshal(u.Stat, &info.Stats); err != nil {
+		return err
+	}
+	return printResource(info)
+}
+
+func setUserQuota(quota admin.QuotaSpec) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.SetUserQuota(context.Background(), quota)
+	if err != nil {
+		return err
+	}
+	return getUserQuota(quota.UID)
+}
+
+// quotaInfo is a user quota with the current usage.
+type quotaInfo struct {
+	UID   string    `json:"user_id"`
+	Quota QuotaSpec `json:"user_quota"`
+	Stats UserStat  `json:"stats"`
+}
+
+func (q quotaInfo) table() table {
+	return table{
+		headers: []string{"UID", "Enabled", "Size", "Objects"},
+		rows: [][]string{{
+			q.UID, formatEnabled(q.Quota.Enabled),
+			formatUsage(q.Stats.Size, q.Quota.MaxSize, true),
+			formatUsage(q.Stats.NumObjects, q.Quota.MaxObjects, false),
+		}},
+	}
+}
+
+func (q quotaInfo) names() []string {
+	return []string{q.UID}
+}
+
+func formatEnabled(enabled *bool) string {
+	return strconv.FormatBool(enabled != nil && *enabled)
+}
+
+// formatUsage formats the used amount next to its limit, e.g. 1.2 GiB / 500.0 GiB.
+func formatUsage(used *uint64, limit *int64, size bool) string {
+	s := "-"
+	if used != nil {
+		s = strconv.FormatUint(*used, 10)
+		if size {
+			s = formatSize(*used)
+		}
+	}
+	return s + " / " + formatLimit(limit, size)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const gib = 1 << 30
+
+// reportCmd represents the report command
+var (
+	reportCmd = &cobra.Command{
+		Use:               "report",
+		Short:             "Reports",
+		Long:              `Reports`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	billingReportCmd = &cobra.Command{
+		Use:   "billing",
+		Short: "Billing report per tenant",
+		Long: `Billing report per tenant for a month.
+
+Storage is a snapshot: RGW keeps no size history, so it is the size of the
+buckets owned by the tenant when the report runs, billed as a full month, for
+any --month. Run the report right after the month ends to bill the storage of
+that month. Egress and requests are taken from the usage log of the month.
+Users with an RGW tenant (tenant$user) are grouped by the tenant, other users
+are billed on their own.
+
+The last row of table, wide, csv and markdown output is the total of the
+month, with the tenant column set to "Total YYYY-MM".
+
+Prices are read from the config file, sizes are in GiB:
+
+pricing:
+  currency: EUR
+  storagePerGBMonth: 0.02
+  egressPerGB: 0.01
+  requestsPer1k: 0.005
+
+cephmgr report billing --month 2026-09 -o markdown`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := billingReport()
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(billingReportCmd)
+
+	billingReportCmd.Flags().StringVar(&reportMonth, "month", "", "Month YYYY-MM (default previous month), storage is always the current size")
+}
+
+func billingReport() error {
+	var pricing Pricing
+	if !viper.IsSet("pricing") {
+		return errNoPricing
+	}
+	if err := viper.UnmarshalKey("pricing", &pricing); err != nil {
+		return err
+	}
+
+	start, err := billingMonth(reportMonth, time.Now())
+	if err != nil {
+		return err
+	}
+	end := start.AddDate(0, 1, 0)
+
+	report := billing{
+		Month:    start.Format("2006-01"),
+		Currency: pricing.Currency,
+		Tenants:  []billingLine{},
+	}
+	lines := map[string]*billingLine{}
+	line := func(uid string) *billingLine {
+		tenant := billingTenant(uid)
+		if lines[tenant] == nil {
+			lines[tenant] = &billingLine{Tenant: tenant}
+		}
+		return lines[tenant]
+	}
+
+	buckets, err := listBucketStats("")
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		size, _, _ := b.totals()
+		line(b.Owner).StorageBytes += size
+	}
+
+	args := url.Values{
+		"start":        {start.Format(usageTimeFormat)},
+		"end":          {end.Format(usageTimeFormat)},
+		"show-entries": {"false"},
+		"show-summary": {"true"},
+	}
+	usage, err := getUsage(args)
+	if err != nil {
+		return err
+	}
+	for _, s := range usage.Summary {
+		l := line(s.User)
+		l.EgressBytes += s.Total.BytesSent
+		l.Requests += s.Total.Ops
+	}
+
+	for _, l := range lines {
+		l.StorageCost = float64(l.StorageBytes) / gib * pricing.StoragePerGBMonth
+		l.EgressCost = float64(l.EgressBytes) / gib * pricing.EgressPerGB
+		l.RequestCost = float64(l.Requests) / 1000 * pricing.RequestsPer1k
+		l.Total = l.StorageCost + l.EgressCost + l.RequestCost
+		report.Tenants = append(report.Tenants, *l)
+		report.Total += l.Total
+	}
+	sort.Slice(report.Tenants, func(i, j int) bool {
+		return report.Tenants[i].Tenant < report.Tenants[j].Tenant
+	})
+	return printResource(report)
+}
+
+// billingMonth returns the start of the month, the previous month when empty.
+func billingMonth(month string, now time.Time) (time.Time, error) {
+	if month == "" {
+		now = now.UTC()
+		return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", errInvalidMonth, month)
+	}
+	return t, nil
+}
+
+// billingTenant returns the RGW tenant of the user, or the user without one.
+func billingTenant(uid string) string {
+	if tenant, _, found := strings.Cut(uid, "$"); found {
+		return tenant
+	}
+	return uid
+}
+
+type billing struct {
+	Month    string        `json:"month"`
+	Currency string        `json:"currency,omitempty"`
+	Tenants  []billingLine `json:"tenants"`
+	Total    float64       `json:"total"`
+}
+
+type billingLine struct {
+	Tenant       string  `json:"tenant"`
+	StorageBytes uint64  `json:"storage_bytes"`
+	EgressBytes  uint64  `json:"egress_bytes"`
+	Requests     uint64  `json:"requests"`
+	StorageCost  float64 `json:"storage_cost"`
+	EgressCost   float64 `json:"egress_cost"`
+	RequestCost  float64 `json:"request_cost"`
+	Total        float64 `json:"total"`
+}
+
+func (b billing) table() table {
+	currency := ""
+	if b.Currency != "" {
+		currency = " (" + b.Currency + ")"
+	}
+	t := table{headers: []string{
+		"Tenant", "Storage GiB", "Egress GiB", "Requests",
+		"Storage" + currency, "Egress" + currency, "Requests" + currency, "Total" + currency,
+	}}
+	for _, l := range b.Tenants {
+		t.rows = append(t.rows, []string{
+			l.Tenant,
+			formatGiB(l.StorageBytes), formatGiB(l.EgressBytes), strconv.FormatUint(l.Requests, 10),
+			formatCost(l.StorageCost), formatCost(l.EgressCost), formatCost(l.RequestCost), formatCost(l.Total),
+		})
+	}
+	t.rows = append(t.rows, []string{"Total " + b.Month, "", "", "", "", "", "", formatCost(b.Total)})
+	return t
+}
+
+func (b billing) names() []string {
+	names := make([]string, 0, len(b.Tenants))
+	for _, l := range b.Tenants {
+		names = append(names, l.Tenant)
+	}
+	return names
+}
+
+func formatGiB(bytes uint64) string {
+	return strconv.FormatFloat(float64(bytes)/gib, 'f', 3, 64)
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 2, 64)
+}
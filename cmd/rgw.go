@@ -27,9 +27,10 @@ import (
 
 // rgwCmd represents the rgw command
 var rgwCmd = &cobra.Command{
-	Use:   "rgw",
-	Short: "rgw module",
-	Long:  `A Ceph rgw module`,
+	Use:               "rgw",
+	Short:             "rgw module",
+	Long:              `A Ceph rgw module`,
+	PersistentPreRunE: selectCluster,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
@@ -32,10 +32,33 @@ import (
 	"github.com/spf13/viper"
 )
 
+const defaultClusterName = "default"
+
 type Config struct {
-	Hostname     string `mapstructure:"hostname"`
-	AccessKey    string `mapstructure:"accessKey"`
-	AccessSecret string `mapstructure:"accessSecret"`
+	CurrentCluster string             `mapstructure:"current-cluster" yaml:"current-cluster"`
+	Clusters       map[string]Cluster `mapstructure:"clusters" yaml:"clusters"`
+	Pricing        *Pricing           `mapstructure:"pricing" yaml:"pricing,omitempty"`
+	// Hostname, AccessKey and AccessSecret describe the single cluster of
+	// config files written before named cluster profiles were introduced.
+	Hostname     string `mapstructure:"hostname" yaml:"hostname,omitempty"`
+	AccessKey    string `mapstructure:"accessKey" yaml:"accessKey,omitempty"`
+	AccessSecret string `mapstructure:"accessSecret" yaml:"accessSecret,omitempty"`
+}
+
+// Pricing is the price sheet of the billing report
+type Pricing struct {
+	Currency          string  `mapstructure:"currency" yaml:"currency,omitempty"`
+	StoragePerGBMonth float64 `mapstructure:"storagePerGBMonth" yaml:"storagePerGBMonth"`
+	EgressPerGB       float64 `mapstructure:"egressPerGB" yaml:"egressPerGB"`
+	RequestsPer1k     float64 `mapstructure:"requestsPer1k" yaml:"requestsPer1k"`
+}
+
+type Cluster struct {
+	Hostname     string `mapstructure:"hostname" yaml:"hostname"`
+	AccessKey    string `mapstructure:"accessKey" yaml:"accessKey"`
+	AccessSecret string `mapstructure:"accessSecret" yaml:"accessSecret"`
+	// Other keys of the cluster, kept when config commands rewrite it
+	Other map[string]interface{} `mapstructure:"-" yaml:",inline" json:"-"`
 }
 
 var (
@@ -50,7 +73,21 @@ You can create credentials with following command from Ceph node:
 
 radosgw-admin user create --uid admin --display name "Administrator" --caps "buckets=*;users=*;usage=read;metadata=read;zone=read"
 
-The command returns the JSON file, from where you can use access_key and secret_key for authentication.`,
+The command returns the JSON file, from where you can use access_key and secret_key for authentication.
+
+Several clusters can be kept in the config file. Select one with --cluster
+or CEPH_CLUSTER, otherwise current-cluster is used:
+
+current-cluster: staging
+clusters:
+  staging:
+    hostname: https://rgw.staging.example.com
+    accessKey: ...
+    accessSecret: ...
+  prod:
+    hostname: https://rgw.example.com
+    accessKey: ...
+    accessSecret: ...`,
 	}
 )
 
@@ -67,66 +104,162 @@ func init() {
 	viper.SetEnvPrefix("CEPH")
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cephmgr.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&cephCluster, "cluster", "C", "", "Ceph cluster from config file (default is current-cluster)")
+	viper.BindPFlag("cluster", rootCmd.PersistentFlags().Lookup("cluster"))
+	viper.BindEnv("cluster")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format: table|wide|json|yaml|csv|markdown|name|go-template=...|jsonpath=...")
 
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
 func initConfig() {
+	viper.AutomaticEnv()
+	viper.SetConfigType("yaml")
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
-		viper.SetConfigType("yaml")
-		viper.ReadInConfig()
 	} else {
 		home, err := os.UserHomeDir()
 		cobra.CheckErr(err)
-		configName := ".cephmgr.yaml"
 		viper.AddConfigPath(home)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(configName)
-		viper.AutomaticEnv()
-
-		if err := viper.ReadInConfig(); err != nil {
-			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-				fmt.Println("Creating default config file")
-				hostname := ReadKey("Ceph S3 Host (with scheme):")
-				viper.Set("hostname", hostname)
-				accesskey := ReadKey("Access key:")
-				viper.Set("accessKey", accesskey)
-				accesssecret := ReadKey("Access secret:")
-				viper.Set("accessSecret", accesssecret)
-				err = viper.WriteConfigAs(filepath.Join(home, configName))
-				if err != nil {
-					fmt.Printf("Cannot write configuration file: %v\n", err)
-				}
-			} else {
-				fmt.Fprintln(os.Stderr, "configfile exists, but something else is wrong")
-			}
+		viper.SetConfigName(".cephmgr.yaml")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "Cannot read config file:", err)
 		}
 	}
+}
 
+// selectCluster resolves the cluster selected with --cluster, CEPH_CLUSTER or
+// the current-cluster setting and makes it the target of the rgw commands.
+func selectCluster(cmd *cobra.Command, args []string) error {
+	if viper.ConfigFileUsed() == "" || !configFileExists() {
+		if err := createDefaultConfig(); err != nil {
+			return err
+		}
+	}
+
+	cluster, err := resolveCluster(viper.GetString("cluster"))
+	if err != nil {
+		return err
+	}
+	connectCluster(cluster)
+	return nil
+}
+
+// connectCluster makes cluster the target of admin API calls.
+func connectCluster(cluster Cluster) {
+	cephHost = cluster.Hostname
+	cephAccessKey = cluster.AccessKey
+	cephAccessSecret = cluster.AccessSecret
+}
+
+// resolveCluster returns the cluster with the given name from the config file.
+// An empty name selects the current cluster.
+func resolveCluster(name string) (Cluster, error) {
 	var config Config
-	err := viper.Unmarshal(&config)
+	if err := viper.Unmarshal(&config); err != nil {
+		return Cluster{}, fmt.Errorf("could not decode config into struct: %w", err)
+	}
+	return config.cluster(name)
+}
+
+func (c Config) cluster(name string) (Cluster, error) {
+	if len(c.Clusters) == 0 && c.Hostname != "" {
+		if name != "" && name != defaultClusterName {
+			return Cluster{}, fmt.Errorf("%w: %s", errClusterNotFound, name)
+		}
+		return Cluster{Hostname: c.Hostname, AccessKey: c.AccessKey, AccessSecret: c.AccessSecret}, nil
+	}
+
+	if name == "" {
+		name = c.CurrentCluster
+	}
+	if name == "" {
+		if len(c.Clusters) != 1 {
+			return Cluster{}, errNoCurrentCluster
+		}
+		for _, cluster := range c.Clusters {
+			return cluster, nil
+		}
+	}
+
+	if cluster, ok := c.Clusters[name]; ok {
+		return cluster, nil
+	}
+	// viper lower-cases map keys when reading the config file
+	if cluster, ok := c.Clusters[strings.ToLower(name)]; ok {
+		return cluster, nil
+	}
+	return Cluster{}, fmt.Errorf("%w: %s", errClusterNotFound, name)
+}
+
+func configFileExists() bool {
+	_, err := os.Stat(viper.ConfigFileUsed())
+	return err == nil
+}
+
+func configFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "could not decode config into struct: %v\n", err)
+		return "", err
 	}
+	return filepath.Join(home, ".cephmgr.yaml"), nil
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Fprintln(os.Stderr, "Cannot read config file:", viper.ConfigFileUsed())
+func createDefaultConfig() error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Creating default config file")
+	hostname := ReadKey("Ceph S3 Host (with scheme):")
+	accesskey := ReadKey("Access key:")
+	accesssecret := ReadKey("Access secret:")
+
+	config := Config{
+		CurrentCluster: defaultClusterName,
+		Clusters: map[string]Cluster{
+			defaultClusterName: {
+				Hostname:     hostname,
+				AccessKey:    accesskey,
+				AccessSecret: accesssecret,
+			},
+		},
+	}
+	if err := writeConfig(path, config); err != nil {
+		return fmt.Errorf("cannot write configuration file: %w", err)
 	}
-	cephHost = config.Hostname
-	cephAccessKey = config.AccessKey
-	cephAccessSecret = config.AccessSecret
+	viper.SetConfigFile(path)
+	return viper.ReadInConfig()
 }
 
+// stdin is shared by all prompts, a reader per prompt would swallow the
+// input buffered for the following ones.
+var stdin = bufio.NewReader(os.Stdin)
+
 func ReadKey(label string) string {
 	var s string
-	r := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Fprint(os.Stderr, label+" ")
-		s, _ = r.ReadString('\n')
-		if s != "" {
+		line, err := stdin.ReadString('\n')
+		s = strings.TrimSpace(line)
+		if s != "" || err != nil {
 			break
 		}
 	}
-	return strings.TrimSpace(s)
+	return s
+}
+
+// confirm asks a yes/no question, anything but y or yes is a no.
+func confirm(question string) bool {
+	fmt.Fprint(os.Stderr, question+" [y/N] ")
+	line, _ := stdin.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
 }
@@ -0,0 +1,482 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+const s3Scheme = "s3://"
+
+// s3Cmd represents the s3 command
+var (
+	s3Cmd = &cobra.Command{
+		Use:   "s3",
+		Short: "S3 object commands",
+		Long: `List, copy, delete and inspect objects through the S3 endpoint of the cluster.
+
+Requests use the keys of the cluster profile, the keys of a user with
+--user, or the keys of the bucket owner with --owner.`,
+		PersistentPreRunE: selectCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	lsS3Cmd = &cobra.Command{
+		Use:   "ls [s3://BUCKET[/PREFIX]]",
+		Short: "List buckets or objects",
+		Long: `List buckets, or the objects and prefixes of a bucket:
+
+cephmgr s3 ls s3://logs/2026/ --owner`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			location := ""
+			if len(args) > 0 {
+				location = args[0]
+			}
+			err := listS3(location)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cpS3Cmd = &cobra.Command{
+		Use:   "cp SRC DST",
+		Short: "Upload or download an object",
+		Long: `Upload a file to a bucket or download an object, large objects are
+transferred in parts. - is stdin or stdout.
+
+cephmgr s3 cp backup.tar s3://backups/2026/
+cephmgr s3 cp s3://backups/2026/backup.tar .`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := copyS3(args[0], args[1])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	rmS3Cmd = &cobra.Command{
+		Use:   "rm s3://BUCKET/KEY",
+		Short: "Delete objects",
+		Long: `Delete an object, or all objects under a prefix with --recursive.
+Recursive deletes show the number of objects and ask for confirmation:
+
+cephmgr s3 rm -r s3://logs/2025/ --dry-run`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := removeS3(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	statS3Cmd = &cobra.Command{
+		Use:   "stat s3://BUCKET/KEY",
+		Short: "Show object details",
+		Long:  `Show object size, ETag, content type and metadata`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := statS3(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(s3Cmd)
+	s3Cmd.AddCommand(lsS3Cmd)
+	s3Cmd.AddCommand(cpS3Cmd)
+	s3Cmd.AddCommand(rmS3Cmd)
+	s3Cmd.AddCommand(statS3Cmd)
+
+	s3Cmd.PersistentFlags().StringVarP(&s3User, "user", "u", "", "Use the keys of user")
+	s3Cmd.PersistentFlags().BoolVar(&s3Owner, "owner", false, "Use the keys of the bucket owner")
+	lsS3Cmd.Flags().BoolVarP(&s3Recursive, "recursive", "r", false, "List all objects under the prefix")
+	rmS3Cmd.Flags().BoolVarP(&s3Recursive, "recursive", "r", false, "Delete all objects under the prefix")
+	rmS3Cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show how many objects would be deleted")
+	rmS3Cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Delete without confirmation")
+}
+
+// parseS3URL splits s3://BUCKET/KEY into bucket and key.
+func parseS3URL(s string) (bucket, key string, err error) {
+	if !strings.HasPrefix(s, s3Scheme) {
+		return "", "", fmt.Errorf("%w: %s", errInvalidS3URL, s)
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(s, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%w: %s", errInvalidS3URL, s)
+	}
+	return bucket, key, nil
+}
+
+// s3Client returns a client with the keys selected by --user and --owner.
+func s3Client(bucket string) (*s3.S3, error) {
+	if s3User == "" && !s3Owner {
+		return newS3Client(cephHost, cephAccessKey, cephAccessSecret)
+	}
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s3User != "" {
+		return userS3Client(c, s3User)
+	}
+	return bucketClient(c, bucket, "")
+}
+
+func listS3(location string) error {
+	if location == "" {
+		if s3Owner {
+			return errOwnerNeedsBucket
+		}
+		client, err := s3Client("")
+		if err != nil {
+			return err
+		}
+		out, err := client.ListBuckets(&s3.ListBucketsInput{})
+		if err != nil {
+			return err
+		}
+		l := s3ObjectList{}
+		for _, b := range out.Buckets {
+			l = append(l, s3ObjectInfo{Key: aws.StringValue(b.Name), Modified: b.CreationDate, Prefix: true})
+		}
+		return printResource(l)
+	}
+
+	bucket, prefix, err := parseS3URL(location)
+	if err != nil {
+		return err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return err
+	}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	if !s3Recursive {
+		input.Delimiter = aws.String("/")
+	}
+	l := s3ObjectList{}
+	err = client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			l = append(l, s3ObjectInfo{Key: aws.StringValue(p.Prefix), Prefix: true})
+		}
+		for _, o := range page.Contents {
+			l = append(l, s3ObjectInfo{
+				Key:          aws.StringValue(o.Key),
+				Size:         aws.Int64Value(o.Size),
+				Modified:     o.LastModified,
+				ETag:         strings.Trim(aws.StringValue(o.ETag), `"`),
+				StorageClass: aws.StringValue(o.StorageClass),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Key < l[j].Key })
+	return printResource(l)
+}
+
+func copyS3(src, dst string) error {
+	srcS3, dstS3 := strings.HasPrefix(src, s3Scheme), strings.HasPrefix(dst, s3Scheme)
+	switch {
+	case srcS3 && !dstS3:
+		return downloadS3(src, dst)
+	case dstS3 && !srcS3:
+		return uploadS3(src, dst)
+	}
+	return errNoS3Side
+}
+
+func uploadS3(src, dst string) error {
+	bucket, key, err := parseS3URL(dst)
+	if err != nil {
+		return err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += filepath.Base(src)
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = os.Stdin
+	if src != "-" {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		body = f
+	}
+	input := &s3manager.UploadInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: body}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if _, err := s3manager.NewUploaderWithClient(client).Upload(input); err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Fprintf(os.Stderr, "Uploaded %s to %s%s/%s\n", src, s3Scheme, bucket, key)
+	}
+	return nil
+}
+
+func downloadS3(src, dst string) error {
+	bucket, key, err := parseS3URL(src)
+	if err != nil {
+		return err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("%w: %s", errInvalidS3URL, src)
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return err
+	}
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+
+	if dst == "-" {
+		obj, err := client.GetObject(input)
+		if err != nil {
+			return err
+		}
+		defer obj.Body.Close()
+		_, err = io.Copy(os.Stdout, obj.Body)
+		return err
+	}
+
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, path.Base(key))
+	}
+	// download next to dst and rename on success, an existing file is kept
+	// when the download fails
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	n, err := s3manager.NewDownloaderWithClient(client).Download(f, input)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Fprintf(os.Stderr, "Downloaded %s to %s (%s)\n", src, dst, formatSize(uint64(n)))
+	}
+	return nil
+}
+
+func removeS3(location string) error {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return err
+	}
+
+	if !s3Recursive {
+		if key == "" {
+			return fmt.Errorf("%w: %s", errInvalidS3URL, location)
+		}
+		_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err == nil && humanOutput() {
+			fmt.Printf("Deleted %s\n", location)
+		}
+		return err
+	}
+
+	var keys []string
+	var size int64
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(key)},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, o := range page.Contents {
+				keys = append(keys, aws.StringValue(o.Key))
+				size += aws.Int64Value(o.Size)
+			}
+			return true
+		})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d objects (%s)\n", location, len(keys), formatSize(uint64(size)))
+
+	if dryRun || len(keys) == 0 {
+		return nil
+	}
+	if !assumeYes && !confirm(fmt.Sprintf("Delete %d objects?", len(keys))) {
+		return errNotConfirmed
+	}
+	deleted, err := deleteObjects(client, bucket, keys)
+	if humanOutput() {
+		fmt.Printf("Deleted %d objects\n", deleted)
+	}
+	return err
+}
+
+func statS3(location string) error {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: %s", errInvalidS3URL, location)
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return err
+	}
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+
+	info := s3ObjectStat{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         aws.Int64Value(head.ContentLength),
+		Modified:     aws.TimeValue(head.LastModified),
+		ETag:         strings.Trim(aws.StringValue(head.ETag), `"`),
+		ContentType:  aws.StringValue(head.ContentType),
+		StorageClass: aws.StringValue(head.StorageClass),
+		VersionID:    aws.StringValue(head.VersionId),
+		Metadata:     map[string]string{},
+	}
+	for k, v := range head.Metadata {
+		info.Metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+	return printResource(info)
+}
+
+// s3ObjectInfo is a listed object, or a bucket or common prefix when Prefix
+// is set.
+type s3ObjectInfo struct {
+	Key          string     `json:"key"`
+	Prefix       bool       `json:"prefix,omitempty"`
+	Size         int64      `json:"size"`
+	Modified     *time.Time `json:"modified,omitempty"`
+	ETag         string     `json:"etag,omitempty"`
+	StorageClass string     `json:"storage_class,omitempty"`
+}
+
+type s3ObjectList []s3ObjectInfo
+
+func (l s3ObjectList) table() table {
+	t := table{headers: []string{"Key", "Size", "Modified", "ETag", "Storage Class"}, wide: 2}
+	for _, o := range l {
+		size, modified := formatSize(uint64(o.Size)), ""
+		if o.Prefix {
+			size = "PRE"
+		}
+		if o.Modified != nil {
+			modified = o.Modified.UTC().Format(time.RFC3339)
+		}
+		t.rows = append(t.rows, []string{o.Key, size, modified, o.ETag, o.StorageClass})
+	}
+	return t
+}
+
+func (l s3ObjectList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, o := range l {
+		names = append(names, o.Key)
+	}
+	return names
+}
+
+type s3ObjectStat struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	Modified     time.Time         `json:"modified"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"content_type"`
+	StorageClass string            `json:"storage_class,omitempty"`
+	VersionID    string            `json:"version_id,omitempty"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+func (s s3ObjectStat) table() table {
+	t := table{headers: []string{"Field", "Value"}}
+	add := func(field, value string) {
+		if value == "" {
+			value = "-"
+		}
+		t.rows = append(t.rows, []string{field, value})
+	}
+	add("Bucket", s.Bucket)
+	add("Key", s.Key)
+	add("Size", fmt.Sprintf("%s (%d bytes)", formatSize(uint64(s.Size)), s.Size))
+	add("Modified", s.Modified.UTC().Format(time.RFC3339))
+	add("ETag", s.ETag)
+	add("Content Type", s.ContentType)
+	add("Storage Class", s.StorageClass)
+	add("Version", s.VersionID)
+	keys := make([]string, 0, len(s.Metadata))
+	for k := range s.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add("Metadata "+k, s.Metadata[k])
+	}
+	return t
+}
+
+func (s s3ObjectStat) names() []string {
+	return []string{s3Scheme + s.Bucket + "/" + s.Key}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ceph/go-ceph/rgw/admin"
+)
+
+// newS3Client returns an S3 client for the RGW endpoint using path style
+// bucket addressing.
+func newS3Client(endpoint, accessKey, secretKey string) (*s3.S3, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String("default"),
+		Credentials:      credentials.NewStaticCredentials(accessKey, secretKey, ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// copySource returns the escaped CopySource of an object.
+func copySource(bucket, key string) string {
+	return url.PathEscape(bucket) + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// bucketClient returns an S3 client using the keys of uid, or of the bucket
+// owner when uid is empty.
+func bucketClient(c *admin.API, bucket, uid string) (*s3.S3, error) {
+	if uid == "" {
+		b, err := c.GetBucketInfo(context.Background(), admin.Bucket{Bucket: bucket})
+		if err != nil {
+			return nil, err
+		}
+		uid = b.Owner
+	}
+	return userS3Client(c, uid)
+}
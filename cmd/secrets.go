@@ -0,0 +1,197 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+)
+
+const (
+	redactedValue = "REDACTED"
+
+	secretFormatEnv            = "env"
+	secretFormatAWSCredentials = "aws-credentials"
+	secretFormatS3cfg          = "s3cfg"
+	secretFormatRclone         = "rclone"
+)
+
+// maskSecrets hides secret keys unless --show-secrets is given.
+func maskSecrets(keys []UserKeySpec) {
+	if showSecrets {
+		return
+	}
+	for i := range keys {
+		if keys[i].SecretKey != "" {
+			keys[i].SecretKey = redactedValue
+		}
+	}
+}
+
+// maskUserSecrets hides the S3 and Swift secret keys of user unless
+// --show-secrets is given.
+func maskUserSecrets(u *User) {
+	maskSecrets(u.Keys)
+	if showSecrets {
+		return
+	}
+	for i := range u.SwiftKeys {
+		if u.SwiftKeys[i].SecretKey != "" {
+			u.SwiftKeys[i].SecretKey = redactedValue
+		}
+	}
+}
+
+// secretOutput is where new credentials are saved with --secret-format and
+// --secret-output-file.
+type secretOutput struct {
+	format string
+	file   *os.File
+	saved  bool
+}
+
+// openSecretOutput validates --secret-format and creates --secret-output-file
+// before any credentials are created, so they can not be lost to a bad flag
+// after the fact. It returns nil when neither flag is given.
+func openSecretOutput() (*secretOutput, error) {
+	if secretOutputFile == "" && secretFormat == "" {
+		return nil, nil
+	}
+	out := &secretOutput{format: secretFormat}
+	if out.format == "" {
+		out.format = secretFormatEnv
+	}
+	switch out.format {
+	case secretFormatEnv, secretFormatAWSCredentials, secretFormatS3cfg, secretFormatRclone:
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownSecretFormat, out.format)
+	}
+
+	if secretOutputFile != "" {
+		// never overwrite an existing credentials file
+		f, err := os.OpenFile(secretOutputFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		out.file = f
+	}
+	return out, nil
+}
+
+// save writes the key to the output file, or to stdout when no file is
+// given. When the file can not be written the key is printed to stdout
+// instead, as it can not be fetched again. It reports whether the key was
+// printed to stdout.
+func (o *secretOutput) save(profile string, key UserKeySpec) bool {
+	return o.write(func(w io.Writer) error {
+		return formatSecrets(w, o.format, profile, key)
+	})
+}
+
+// saveAll saves the keys of several users like save, each under a comment
+// naming the user, with the user as profile.
+func (o *secretOutput) saveAll(keys []UserKeySpec) bool {
+	return o.write(func(w io.Writer) error {
+		for i, k := range keys {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "# %s\n", k.User)
+			if err := formatSecrets(w, o.format, k.User, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (o *secretOutput) write(format func(w io.Writer) error) bool {
+	o.saved = true
+	if o.file == nil {
+		format(os.Stdout)
+		return true
+	}
+
+	err := format(o.file)
+	if cerr := o.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(o.file.Name())
+		fmt.Fprintf(os.Stderr, "Writing %s failed: %v\n", o.file.Name(), err)
+		format(os.Stdout)
+		return true
+	}
+	if humanOutput() {
+		fmt.Fprintf(os.Stderr, "Credentials written to %s\n", o.file.Name())
+	}
+	return false
+}
+
+// discard removes the output file when no credentials were saved to it.
+func (o *secretOutput) discard() {
+	if o == nil || o.saved || o.file == nil {
+		return
+	}
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
+
+func formatSecrets(w io.Writer, format, profile string, key UserKeySpec) error {
+	switch format {
+	case secretFormatEnv:
+		fmt.Fprintf(w, "export AWS_ACCESS_KEY_ID=%s\n", key.AccessKey)
+		fmt.Fprintf(w, "export AWS_SECRET_ACCESS_KEY=%s\n", key.SecretKey)
+		fmt.Fprintf(w, "export AWS_ENDPOINT_URL=%s\n", cephHost)
+	case secretFormatAWSCredentials:
+		fmt.Fprintf(w, "[%s]\n", profile)
+		fmt.Fprintf(w, "aws_access_key_id = %s\n", key.AccessKey)
+		fmt.Fprintf(w, "aws_secret_access_key = %s\n", key.SecretKey)
+	case secretFormatS3cfg:
+		u, err := url.Parse(cephHost)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "[default]")
+		fmt.Fprintf(w, "access_key = %s\n", key.AccessKey)
+		fmt.Fprintf(w, "secret_key = %s\n", key.SecretKey)
+		fmt.Fprintf(w, "host_base = %s\n", u.Host)
+		fmt.Fprintf(w, "host_bucket = %s\n", u.Host)
+		useHTTPS := "False"
+		if u.Scheme == "https" {
+			useHTTPS = "True"
+		}
+		fmt.Fprintf(w, "use_https = %s\n", useHTTPS)
+	case secretFormatRclone:
+		fmt.Fprintf(w, "[%s]\n", profile)
+		fmt.Fprintln(w, "type = s3")
+		fmt.Fprintln(w, "provider = Ceph")
+		fmt.Fprintf(w, "access_key_id = %s\n", key.AccessKey)
+		fmt.Fprintf(w, "secret_access_key = %s\n", key.SecretKey)
+		fmt.Fprintf(w, "endpoint = %s\n", cephHost)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownSecretFormat, format)
+	}
+	return nil
+}
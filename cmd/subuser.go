@@ -0,0 +1,330 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+const (
+	keyTypeS3    = "s3"
+	keyTypeSwift = "swift"
+)
+
+// subuserCmd represents the subuser command
+var (
+	subuserCmd = &cobra.Command{
+		Use:   "subuser",
+		Short: "Subusers operations",
+		Long:  `Create, modify, remove and list Swift and S3 subusers`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	listSubusersCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List subusers",
+		Long:  `List user subusers with their keys`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := listSubusers(userName, "")
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	createSubuserCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create subuser",
+		Long: `Create subuser with read, write, readwrite or full access:
+
+cephmgr rgw user subuser create --user alice --subuser swift --access full
+
+A secret is generated unless --secret-key is given. Swift subusers get a
+Swift secret key, S3 subusers (--key-type s3) get an S3 key pair.
+Secret keys are not shown unless --show-secrets is given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" || subuserName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := createSubuser(userName, subuserID(userName, subuserName))
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	modifySubuserCmd = &cobra.Command{
+		Use:   "modify",
+		Short: "Modify subuser",
+		Long: `Change subuser access level or secret key.
+
+Give a new secret with --secret-key or generate one with --generate-secret.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" || subuserName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := modifySubuser(userName, subuserID(userName, subuserName))
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	removeSubuserCmd = &cobra.Command{
+		Use:   "remove",
+		Short: "Remove subuser",
+		Long:  `Remove subuser and its keys, keep the keys with --keep-keys`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if userName == "" || subuserName == "" {
+				cmd.Help()
+				os.Exit(1)
+			}
+			err := removeSubuser(userName, subuserID(userName, subuserName))
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	userCmd.AddCommand(subuserCmd)
+	subuserCmd.AddCommand(listSubusersCmd)
+	subuserCmd.AddCommand(createSubuserCmd)
+	subuserCmd.AddCommand(modifySubuserCmd)
+	subuserCmd.AddCommand(removeSubuserCmd)
+
+	for _, c := range []*cobra.Command{createSubuserCmd, modifySubuserCmd, removeSubuserCmd} {
+		c.Flags().StringVar(&subuserName, "subuser", "", "Subuser name, with or without the \"user:\" prefix")
+		c.MarkFlagRequired("subuser")
+	}
+	for _, c := range []*cobra.Command{createSubuserCmd, modifySubuserCmd} {
+		c.Flags().StringVar(&subuserAccess, "access", "", "Access level: read|write|readwrite|full")
+		c.Flags().StringVar(&subuserKeyType, "key-type", keyTypeSwift, "Key type: swift|s3")
+		c.Flags().StringVar(&subuserSecret, "secret-key", "", "Secret key, generated when not given")
+	}
+	modifySubuserCmd.Flags().BoolVar(&subuserGenerateSecret, "generate-secret", false, "Generate a new secret key")
+	removeSubuserCmd.Flags().BoolVar(&subuserKeepKeys, "keep-keys", false, "Keep subuser keys")
+}
+
+// subuserID returns the full "user:subuser" ID of a subuser.
+func subuserID(uid, name string) string {
+	if strings.Contains(name, ":") {
+		return name
+	}
+	return uid + ":" + name
+}
+
+// generateSecret returns a random secret like the ones RGW generates. go-ceph
+// does not pass the generate-secret parameter to the subuser API.
+func generateSecret() (string, error) {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 40)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func createSubuser(uid, id string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	subuser := admin.SubuserSpec{Name: id, Access: admin.SubuserAccess(subuserAccess)}
+	if subuserKeyType == keyTypeSwift {
+		secret := subuserSecret
+		if secret == "" {
+			if secret, err = generateSecret(); err != nil {
+				return err
+			}
+		}
+		keyType := keyTypeSwift
+		subuser.SecretKey = &secret
+		subuser.KeyType = &keyType
+	}
+
+	err = c.CreateSubuser(context.Background(), admin.User{ID: uid}, subuser)
+	if err != nil {
+		return err
+	}
+
+	if subuserKeyType == keyTypeS3 {
+		// the subuser API cannot create S3 keys through go-ceph
+		args := url.Values{}
+		args.Set("uid", uid)
+		args.Set("subuser", id)
+		args.Set("key-type", keyTypeS3)
+		if subuserSecret != "" {
+			args.Set("secret-key", subuserSecret)
+		}
+		args.Set("generate-key", "true")
+		if _, err := adminCall(context.Background(), http.MethodPut, "/user?key", args); err != nil {
+			return err
+		}
+	}
+
+	return listSubusers(uid, id)
+}
+
+func modifySubuser(uid, id string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	subuser := admin.SubuserSpec{Name: id, Access: admin.SubuserAccess(subuserAccess)}
+	secret := subuserSecret
+	if secret == "" && subuserGenerateSecret {
+		if secret, err = generateSecret(); err != nil {
+			return err
+		}
+	}
+	if secret != "" {
+		keyType := subuserKeyType
+		subuser.Secret = &secret
+		subuser.KeyType = &keyType
+	}
+	if subuser.Access == admin.SubuserAccessNone && subuser.Secret == nil {
+		return errNothingToModify
+	}
+
+	err = c.ModifySubuser(context.Background(), admin.User{ID: uid}, subuser)
+	if err != nil {
+		return err
+	}
+	return listSubusers(uid, id)
+}
+
+func removeSubuser(uid, id string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	purgeKeys := !subuserKeepKeys
+	err = c.RemoveSubuser(context.Background(), admin.User{ID: uid}, admin.SubuserSpec{Name: id, PurgeKeys: &purgeKeys})
+	if err != nil {
+		return err
+	}
+	if humanOutput() {
+		fmt.Printf("Removed subuser %s\n", id)
+	}
+	return nil
+}
+
+// listSubusers prints the subusers of uid, or only the subuser id when given.
+func listSubusers(uid, id string) error {
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	u, err := c.GetUser(context.Background(), admin.User{ID: uid})
+	if err != nil {
+		return err
+	}
+
+	var userdata User
+	if err := remarshal(u, &userdata); err != nil {
+		return err
+	}
+	maskUserSecrets(&userdata)
+
+	l := subuserList{}
+	for _, su := range userdata.Subusers {
+		if id != "" && su.ID != id {
+			continue
+		}
+		info := subuserInfo{ID: su.ID, Permissions: su.Permissions}
+		for _, k := range userdata.Keys {
+			if k.User == su.ID {
+				info.Keys = append(info.Keys, subuserKey{Type: keyTypeS3, AccessKey: k.AccessKey, SecretKey: k.SecretKey})
+			}
+		}
+		for _, k := range userdata.SwiftKeys {
+			if k.User == su.ID {
+				info.Keys = append(info.Keys, subuserKey{Type: keyTypeSwift, SecretKey: k.SecretKey})
+			}
+		}
+		l = append(l, info)
+	}
+	return printResource(l)
+}
+
+type subuserKey struct {
+	Type      string `json:"type"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key"`
+}
+
+type subuserInfo struct {
+	ID          string       `json:"id"`
+	Permissions string       `json:"permissions"`
+	Keys        []subuserKey `json:"keys"`
+}
+
+type subuserList []subuserInfo
+
+func (l subuserList) table() table {
+	t := table{headers: []string{"Subuser", "Permissions", "Key Type", "Access Key", "Secret Key"}}
+	for _, su := range l {
+		if len(su.Keys) == 0 {
+			t.rows = append(t.rows, []string{su.ID, su.Permissions, "", "", ""})
+		}
+		for _, k := range su.Keys {
+			t.rows = append(t.rows, []string{su.ID, su.Permissions, k.Type, k.AccessKey, k.SecretKey})
+		}
+	}
+	return t
+}
+
+func (l subuserList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, su := range l {
+		names = append(names, su.ID)
+	}
+	return names
+}
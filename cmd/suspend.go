@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// suspendCmd represents the suspend command
+var (
+	suspendCmd = &cobra.Command{
+		Use:   "suspend",
+		Short: "Suspend users",
+		Long: `Suspend users without removing their data.
+
+Suspend a list of users, one user ID per line, from a file or stdin:
+
+cephmgr rgw user suspend --from-file users.txt
+cat users.txt | cephmgr rgw user suspend --from-file -`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := setUsersSuspended(true)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+	enableCmd = &cobra.Command{
+		Use:   "enable",
+		Short: "Enable suspended users",
+		Long: `Enable suspended users.
+
+Enable a list of users, one user ID per line, from a file or stdin:
+
+cephmgr rgw user enable --from-file users.txt
+cat users.txt | cephmgr rgw user enable --from-file -`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := setUsersSuspended(false)
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	userCmd.AddCommand(suspendCmd)
+	userCmd.AddCommand(enableCmd)
+
+	suspendCmd.Flags().StringVar(&usersFile, "from-file", "", "File with user IDs, - for stdin")
+	enableCmd.Flags().StringVar(&usersFile, "from-file", "", "File with user IDs, - for stdin")
+}
+
+func setUsersSuspended(suspend bool) error {
+	uids, err := selectedUsers()
+	if err != nil {
+		return err
+	}
+
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return err
+	}
+
+	suspended := 0
+	if suspend {
+		suspended = 1
+	}
+
+	result := userInfoList{}
+	failed := 0
+	for _, uid := range uids {
+		u, err := c.ModifyUser(context.Background(), admin.User{ID: uid, Suspended: &suspended})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", uid, err)
+			failed++
+			continue
+		}
+
+		var userdata User
+		if err := remarshal(u, &userdata); err != nil {
+			return err
+		}
+		maskUserSecrets(&userdata)
+		result = append(result, userdata)
+	}
+
+	if err := printResource(result); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d users", errBulkFailed, failed, len(uids))
+	}
+	return nil
+}
+
+// selectedUsers returns the user given with --user or the users listed in
+// --from-file.
+func selectedUsers() ([]string, error) {
+	if usersFile == "" {
+		if userName == "" {
+			return nil, errMissingUserID
+		}
+		return []string{userName}, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if usersFile != "-" {
+		f, err := os.Open(usersFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return readUserIDs(r)
+}
+
+// readUserIDs reads one user ID per line, skipping empty lines and # comments.
+func readUserIDs(r io.Reader) ([]string, error) {
+	var uids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		uids = append(uids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(uids) == 0 {
+		return nil, errMissingUserID
+	}
+	return uids, nil
+}
+
+// userInfoList is the result of a change made to several users.
+type userInfoList []User
+
+func (l userInfoList) table() table {
+	t := User{}.table()
+	t.rows = nil
+	for _, u := range l {
+		t.rows = append(t.rows, u.table().rows...)
+	}
+	return t
+}
+
+func (l userInfoList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, u := range l {
+		names = append(names, u.ID)
+	}
+	return names
+}
@@ -0,0 +1,526 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// checkpointInterval is how often the sync checkpoint is saved
+	checkpointInterval = 10 * time.Second
+	// sourceETagMeta is the metadata key of copies holding the source ETag
+	sourceETagMeta = "Cephmgr-Source-Etag"
+)
+
+// bucketDataCmd represents the top level bucket command
+var (
+	bucketDataCmd = &cobra.Command{
+		Use:   "bucket",
+		Short: "Bucket data commands",
+		Long:  `Bucket data commands over S3`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	syncBucketCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Copy bucket objects between clusters",
+		Long: `Copy objects from one bucket to another, on the same or another configured
+cluster. Buckets are given as CLUSTER:BUCKET, or BUCKET for the current cluster.
+
+cephmgr bucket sync --src prod:bucketA --dst dr:bucketA --delete
+
+Objects are read and written with the S3 keys of the bucket owners, or of
+--src-user and --dst-user. A missing destination bucket is created when
+--dst-user is given.
+
+Objects with the same size and ETag in both buckets are skipped. Objects
+uploaded in parts get a different ETag, so the source ETag is stored in the
+x-amz-meta-cephmgr-source-etag metadata of every copy and compared instead.
+Copied objects are also recorded in a checkpoint file, so an interrupted sync
+resumes where it stopped without checking them again.
+--delete removes objects missing from the source bucket.
+
+Metadata, content headers and tags are copied. Object ACLs and server-side
+encryption are not: copies get the default ACL of the destination user and
+the default encryption of the destination bucket, and objects encrypted with
+customer keys (SSE-C) fail to copy.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := syncBucket(syncSrc, syncDst)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(bucketDataCmd)
+	bucketDataCmd.AddCommand(syncBucketCmd)
+
+	syncBucketCmd.Flags().StringVar(&syncSrc, "src", "", "Source CLUSTER:BUCKET")
+	syncBucketCmd.Flags().StringVar(&syncDst, "dst", "", "Destination CLUSTER:BUCKET")
+	syncBucketCmd.Flags().StringVar(&syncSrcUser, "src-user", "", "Read as user (default bucket owner)")
+	syncBucketCmd.Flags().StringVar(&syncDstUser, "dst-user", "", "Write as user (default bucket owner)")
+	syncBucketCmd.Flags().BoolVar(&syncDelete, "delete", false, "Delete objects missing from the source")
+	syncBucketCmd.Flags().IntVar(&syncWorkers, "workers", 8, "Objects copied in parallel")
+	syncBucketCmd.Flags().StringVar(&syncCheckpointFile, "checkpoint", "", "Checkpoint file (default in the user cache directory)")
+	syncBucketCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be copied and deleted")
+	syncBucketCmd.MarkFlagRequired("src")
+	syncBucketCmd.MarkFlagRequired("dst")
+}
+
+// bucketRef is a bucket on a configured cluster
+type bucketRef struct {
+	cluster string
+	bucket  string
+}
+
+func parseBucketRef(s string) (bucketRef, error) {
+	ref := bucketRef{bucket: s}
+	if cluster, bucket, found := strings.Cut(s, ":"); found {
+		ref = bucketRef{cluster: cluster, bucket: bucket}
+	}
+	if ref.bucket == "" || strings.Contains(ref.bucket, "/") {
+		return ref, fmt.Errorf("%w: %s", errInvalidBucketRef, s)
+	}
+	return ref, nil
+}
+
+// resolve returns the cluster of the bucket, the current cluster when none
+// is given.
+func (r bucketRef) resolve() (Cluster, error) {
+	name := r.cluster
+	if name == "" {
+		name = viper.GetString("cluster")
+	}
+	return resolveCluster(name)
+}
+
+func (r bucketRef) String() string {
+	if r.cluster == "" {
+		return r.bucket
+	}
+	return r.cluster + ":" + r.bucket
+}
+
+// s3Object is the part of a listed object compared by sync
+type s3Object struct {
+	Size int64
+	ETag string
+}
+
+// syncCheckpoint records the source ETag of copied objects
+type syncCheckpoint struct {
+	Source      string            `json:"source"`
+	Destination string            `json:"destination"`
+	Copied      map[string]string `json:"copied"`
+
+	path string
+	mu   sync.Mutex
+}
+
+type syncResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Copied      int    `json:"copied"`
+	Skipped     int    `json:"skipped"`
+	Deleted     int    `json:"deleted"`
+	Failed      int    `json:"failed"`
+	Bytes       int64  `json:"bytes"`
+}
+
+func syncBucket(src, dst string) error {
+	srcRef, err := parseBucketRef(src)
+	if err != nil {
+		return err
+	}
+	dstRef, err := parseBucketRef(dst)
+	if err != nil {
+		return err
+	}
+	srcCluster, err := srcRef.resolve()
+	if err != nil {
+		return fmt.Errorf("%s: %w", srcRef, err)
+	}
+	dstCluster, err := dstRef.resolve()
+	if err != nil {
+		return fmt.Errorf("%s: %w", dstRef, err)
+	}
+	if srcCluster.Hostname == dstCluster.Hostname && srcRef.bucket == dstRef.bucket {
+		return fmt.Errorf("%w: %s", errSameBucket, srcRef)
+	}
+	if syncWorkers < 1 {
+		syncWorkers = 1
+	}
+
+	srcClient, err := clusterBucketClient(srcCluster, srcRef.bucket, syncSrcUser, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", srcRef, err)
+	}
+	dstClient, err := clusterBucketClient(dstCluster, dstRef.bucket, syncDstUser, !dryRun)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dstRef, err)
+	}
+
+	checkpoint, err := loadCheckpoint(syncCheckpointFile, srcRef, dstRef)
+	if err != nil {
+		return err
+	}
+
+	srcObjects, err := listObjects(srcClient, srcRef.bucket)
+	if err != nil {
+		return fmt.Errorf("%s: %w", srcRef, err)
+	}
+	dstObjects, err := listObjects(dstClient, dstRef.bucket)
+	if err != nil && !isNoSuchBucket(err) {
+		return fmt.Errorf("%s: %w", dstRef, err)
+	}
+
+	result := syncResult{Source: srcRef.String(), Destination: dstRef.String()}
+	var keys []string
+	for key, o := range srcObjects {
+		d, ok := dstObjects[key]
+		if ok && d.Size == o.Size && (d.ETag == o.ETag || checkpoint.Copied[key] == o.ETag) {
+			result.Skipped++
+			continue
+		}
+		if ok && d.Size == o.Size {
+			same, err := copiedFrom(dstClient, dstRef.bucket, key, o.ETag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", dstRef, err)
+			}
+			if same {
+				checkpoint.done(key, o.ETag)
+				result.Skipped++
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	var extra []string
+	if syncDelete {
+		for key := range dstObjects {
+			if _, ok := srcObjects[key]; !ok {
+				extra = append(extra, key)
+			}
+		}
+	}
+
+	if dryRun {
+		for _, key := range keys {
+			fmt.Fprintf(os.Stderr, "copy %s (%s)\n", key, formatSize(uint64(srcObjects[key].Size)))
+			result.Bytes += srcObjects[key].Size
+		}
+		for _, key := range extra {
+			fmt.Fprintf(os.Stderr, "delete %s\n", key)
+		}
+		result.Copied = len(keys)
+		result.Deleted = len(extra)
+		return printResource(result)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	uploader := s3manager.NewUploaderWithClient(dstClient)
+	stop := checkpoint.saveEvery(checkpointInterval)
+	for w := 0; w < syncWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				err := copyObject(srcClient, uploader, srcRef.bucket, dstRef.bucket, key)
+				mu.Lock()
+				if err != nil {
+					result.Failed++
+					fmt.Fprintf(os.Stderr, "%s: %v\n", key, err)
+				} else {
+					result.Copied++
+					result.Bytes += srcObjects[key].Size
+				}
+				mu.Unlock()
+				if err == nil {
+					checkpoint.done(key, srcObjects[key].ETag)
+				}
+			}
+		}()
+	}
+	for _, key := range keys {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+	stop()
+	if err := checkpoint.save(); err != nil {
+		return err
+	}
+
+	if len(extra) > 0 {
+		deleted, err := deleteObjects(dstClient, dstRef.bucket, extra)
+		result.Deleted = deleted
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := printResource(result); err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%w: %d objects not copied", errSyncFailed, result.Failed)
+	}
+	return nil
+}
+
+// clusterBucketClient returns an S3 client for the bucket on the cluster,
+// with the keys of uid or the bucket owner. With create and uid the bucket
+// is created as uid when it does not exist.
+func clusterBucketClient(cluster Cluster, bucket, uid string, create bool) (*s3.S3, error) {
+	connectCluster(cluster)
+	c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := bucketClient(c, bucket, uid)
+	if err != nil || uid == "" || !create {
+		return client, err
+	}
+	_, err = client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if !isNoSuchBucket(err) {
+		return client, err
+	}
+	_, err = client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	return client, err
+}
+
+func listObjects(client *s3.S3, bucket string) (map[string]s3Object, error) {
+	objects := map[string]s3Object{}
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, o := range page.Contents {
+				objects[aws.StringValue(o.Key)] = s3Object{
+					Size: aws.Int64Value(o.Size),
+					ETag: strings.Trim(aws.StringValue(o.ETag), `"`),
+				}
+			}
+			return true
+		})
+	return objects, err
+}
+
+// isNoSuchBucket reports a missing bucket, HeadBucket has no error body and
+// reports it as NotFound.
+func isNoSuchBucket(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeNoSuchBucket || aerr.Code() == "NotFound")
+}
+
+// copiedFrom reports whether the object in the destination bucket is a copy
+// of the source object with the given ETag.
+func copiedFrom(dst *s3.S3, bucket, key, etag string) (bool, error) {
+	head, err := dst.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return false, err
+	}
+	return aws.StringValue(head.Metadata[sourceETagMeta]) == etag, nil
+}
+
+// copyObject streams the object from the source to the destination bucket,
+// large objects are uploaded in parts. The source ETag is kept in the
+// metadata, as the ETag of an object uploaded in parts differs.
+func copyObject(src *s3.S3, uploader *s3manager.Uploader, srcBucket, dstBucket, key string) error {
+	obj, err := src.GetObject(&s3.GetObjectInput{Bucket: aws.String(srcBucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	var tagging *string
+	if aws.Int64Value(obj.TagCount) > 0 {
+		tags, err := src.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String(srcBucket), Key: aws.String(key)})
+		if err != nil {
+			return err
+		}
+		values := url.Values{}
+		for _, t := range tags.TagSet {
+			values.Set(aws.StringValue(t.Key), aws.StringValue(t.Value))
+		}
+		tagging = aws.String(values.Encode())
+	}
+	metadata := obj.Metadata
+	if metadata == nil {
+		metadata = map[string]*string{}
+	}
+	metadata[sourceETagMeta] = aws.String(strings.Trim(aws.StringValue(obj.ETag), `"`))
+
+	_, err = uploader.Upload(&s3manager.UploadInput{
+		Bucket:             aws.String(dstBucket),
+		Key:                aws.String(key),
+		Body:               obj.Body,
+		ContentType:        obj.ContentType,
+		ContentEncoding:    obj.ContentEncoding,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		CacheControl:       obj.CacheControl,
+		Metadata:           metadata,
+		Tagging:            tagging,
+	})
+	return err
+}
+
+// deleteObjects deletes keys in batches of 1000, the S3 limit.
+func deleteObjects(client *s3.S3, bucket string, keys []string) (int, error) {
+	deleted := 0
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 1000 {
+			n = 1000
+		}
+		batch := &s3.Delete{Quiet: aws.Bool(true)}
+		for _, key := range keys[:n] {
+			batch.Objects = append(batch.Objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := client.DeleteObjects(&s3.DeleteObjectsInput{Bucket: aws.String(bucket), Delete: batch})
+		if err != nil {
+			return deleted, err
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+		deleted += n - len(out.Errors)
+		keys = keys[n:]
+	}
+	return deleted, nil
+}
+
+// loadCheckpoint reads the checkpoint of a sync, a new one when the file does
+// not exist.
+func loadCheckpoint(path string, src, dst bucketRef) (*syncCheckpoint, error) {
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(src.String() + "\x00" + dst.String()))
+		path = filepath.Join(dir, "cephmgr", "sync-"+hex.EncodeToString(sum[:8])+".json")
+	}
+
+	cp := &syncCheckpoint{Source: src.String(), Destination: dst.String(), Copied: map[string]string{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cp.Copied == nil {
+		cp.Copied = map[string]string{}
+	}
+	return cp, nil
+}
+
+func (cp *syncCheckpoint) done(key, etag string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Copied[key] = etag
+}
+
+func (cp *syncCheckpoint) save() error {
+	cp.mu.Lock()
+	data, err := json.Marshal(cp)
+	cp.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0700); err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
+
+// saveEvery saves the checkpoint periodically until the returned function is
+// called.
+func (cp *syncCheckpoint) saveEvery(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := cp.save(); err != nil {
+					fmt.Fprintf(os.Stderr, "checkpoint: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+func (r syncResult) table() table {
+	return table{
+		headers: []string{"Source", "Destination", "Copied", "Skipped", "Deleted", "Failed", "Size"},
+		rows: [][]string{{
+			r.Source, r.Destination,
+			strconv.Itoa(r.Copied), strconv.Itoa(r.Skipped), strconv.Itoa(r.Deleted), strconv.Itoa(r.Failed),
+			formatSize(uint64(r.Bytes)),
+		}},
+	}
+}
+
+func (r syncResult) names() []string {
+	return []string{r.Destination}
+}
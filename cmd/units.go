@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// parseSize parses a size like 500G, 1.5TiB or 1048576 into bytes. Units are
+// powers of 1024 like in radosgw-admin, -1 means unlimited.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "-1" {
+		return -1, nil
+	}
+
+	upper := strings.ToUpper(s)
+	upper = strings.TrimSuffix(upper, "B")
+	upper = strings.TrimSuffix(upper, "I")
+
+	multiplier := int64(1)
+	if upper != "" {
+		if i := strings.IndexByte("KMGTPE", upper[len(upper)-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			upper = upper[:len(upper)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	// float64(math.MaxInt64) rounds up to 2^63, which does not fit either
+	if err != nil || math.IsNaN(n) || n < 0 || n*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %s", errInvalidSize, s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatSize formats bytes with binary units, e.g. 1.5 GiB.
+func formatSize(bytes uint64) string {
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", value, sizeUnits[unit])
+}
+
+// formatLimit formats a quota size or object limit, negative is unlimited.
+func formatLimit(limit *int64, size bool) string {
+	if limit == nil || *limit < 0 {
+		return "unlimited"
+	}
+	if size {
+		return formatSize(uint64(*limit))
+	}
+	return strconv.FormatInt(*limit, 10)
+}
+
+// parseRetention parses a duration with day and week units, e.g. 90d or 12w,
+// in addition to the units of time.ParseDuration.
+func parseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit == 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("%w: %s", errInvalidDuration, s)
+		}
+		return d, nil
+	}
+
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidDuration, s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatSizeExact formats bytes with the largest unit that keeps the value
+// exact, e.g. 500G or 1536M, so that parseSize returns the same value.
+func formatSizeExact(bytes int64) string {
+	if bytes <= 0 {
+		return strconv.FormatInt(bytes, 10)
+	}
+	unit := 0
+	for unit < 6 && bytes%1024 == 0 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return strconv.FormatInt(bytes, 10)
+	}
+	return strconv.FormatInt(bytes, 10) + string("KMGTPE"[unit-1])
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  error
+	}{
+		{"0", 0, nil},
+		{"1048576", 1048576, nil},
+		{"-1", -1, nil},
+		{" 500G ", 500 << 30, nil},
+		{"1.5G", 3 << 29, nil},
+		{"10GiB", 10 << 30, nil},
+		{"10gb", 10 << 30, nil},
+		{"2k", 2048, nil},
+		{"1T", 1 << 40, nil},
+		{"7E", 7 << 60, nil},
+		{"8E", 0, errInvalidSize},
+		{"9223372036854775807", 0, errInvalidSize},
+		{"1e30", 0, errInvalidSize},
+		{"NaN", 0, errInvalidSize},
+		{"Inf", 0, errInvalidSize},
+		{"-Inf", 0, errInvalidSize},
+		{"-2", 0, errInvalidSize},
+		{"", 0, errInvalidSize},
+		{"G", 0, errInvalidSize},
+		{"ten", 0, errInvalidSize},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("parseSize(%q) = %d, %v, want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		in   uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{3 << 29, "1.5 GiB"},
+		{1 << 60, "1.0 EiB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.in); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
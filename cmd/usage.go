@@ -0,0 +1,198 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// usageTimeFormat is the time format of the RGW usage log
+const usageTimeFormat = "2006-01-02 15:04:05"
+
+// usageCmd represents the usage command
+var (
+	usageCmd = &cobra.Command{
+		Use:   "usage",
+		Short: "Usage log commands",
+		Long:  `Usage log commands, the usage log must be enabled with rgw_enable_usage_log`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	showUsageCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Show usage",
+		Long: `Show operation and byte counts per user, bucket and category.
+
+Show the usage of a user in September as CSV:
+
+cephmgr rgw usage show --user alice --start 2026-09-01 --end 2026-10-01 -o csv
+
+Show only object reads and writes, summed per user:
+
+cephmgr rgw usage show --categories get_obj,put_obj --summary`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := showUsage()
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	rgwCmd.AddCommand(usageCmd)
+	usageCmd.AddCommand(showUsageCmd)
+
+	showUsageCmd.Flags().StringVarP(&userName, "user", "u", "", "User ID")
+	showUsageCmd.Flags().StringVar(&usageStart, "start", "", "Start time, YYYY-MM-DD[ HH:MM:SS]")
+	showUsageCmd.Flags().StringVar(&usageEnd, "end", "", "End time, YYYY-MM-DD[ HH:MM:SS]")
+	showUsageCmd.Flags().StringVar(&usageCategories, "categories", "", "Comma separated categories, e.g. get_obj,put_obj")
+	showUsageCmd.Flags().BoolVar(&usageSummary, "summary", false, "Show only the summary per user")
+}
+
+func showUsage() error {
+	args := url.Values{}
+	if userName != "" {
+		args.Set("uid", userName)
+	}
+	if err := setUsageTime(args, "start", usageStart); err != nil {
+		return err
+	}
+	if err := setUsageTime(args, "end", usageEnd); err != nil {
+		return err
+	}
+	if usageCategories != "" {
+		args.Set("categories", usageCategories)
+	}
+	args.Set("show-summary", "true")
+	args.Set("show-entries", strconv.FormatBool(!usageSummary))
+
+	usage, err := getUsage(args)
+	if err != nil {
+		return err
+	}
+	if usageSummary {
+		return printResource(usageSummaryList(usage.Summary))
+	}
+	return printResource(usageEntryList(usage.Entries))
+}
+
+// getUsage reads the usage log. go-ceph's GetUsage has no uid and
+// categories parameters, so the admin API is called directly.
+func getUsage(args url.Values) (Usage, error) {
+	usage := Usage{Entries: []UsageEntry{}, Summary: []UsageSummary{}}
+	body, err := adminCall(context.Background(), http.MethodGet, "/usage", args)
+	if err != nil {
+		return usage, err
+	}
+	err = json.Unmarshal(body, &usage)
+	return usage, err
+}
+
+func setUsageTime(args url.Values, key, value string) error {
+	if value == "" {
+		return nil
+	}
+	t, err := parseUsageTime(value)
+	if err != nil {
+		return err
+	}
+	args.Set(key, t.Format(usageTimeFormat))
+	return nil
+}
+
+// parseUsageTime parses a date or a date and time in UTC.
+func parseUsageTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", usageTimeFormat, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %s", errInvalidTime, s)
+}
+
+type usageEntryList []UsageEntry
+
+func (l usageEntryList) table() table {
+	t := table{headers: []string{"User", "Bucket", "Time", "Category", "Ops", "Successful Ops", "Bytes Sent", "Bytes Received"}}
+	for _, e := range l {
+		for _, b := range e.Buckets {
+			for _, c := range b.Categories {
+				t.rows = append(t.rows, append([]string{e.User, b.Bucket, b.Time}, c.row()...))
+			}
+		}
+	}
+	return t
+}
+
+func (l usageEntryList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, e := range l {
+		names = append(names, e.User)
+	}
+	return names
+}
+
+type usageSummaryList []UsageSummary
+
+func (l usageSummaryList) table() table {
+	t := table{headers: []string{"User", "Category", "Ops", "Successful Ops", "Bytes Sent", "Bytes Received"}}
+	for _, s := range l {
+		for _, c := range s.Categories {
+			t.rows = append(t.rows, append([]string{s.User}, c.row()...))
+		}
+		total := s.Total
+		total.Category = "total"
+		t.rows = append(t.rows, append([]string{s.User}, total.row()...))
+	}
+	return t
+}
+
+func (l usageSummaryList) names() []string {
+	names := make([]string, 0, len(l))
+	for _, s := range l {
+		names = append(names, s.User)
+	}
+	return names
+}
+
+// row returns the category columns. Byte counts are exact so that CSV output
+// can be used for accounting.
+func (c UsageCategory) row() []string {
+	return []string{
+		c.Category,
+		strconv.FormatUint(c.Ops, 10),
+		strconv.FormatUint(c.SuccessfulOps, 10),
+		strconv.FormatUint(c.BytesSent, 10),
+		strconv.FormatUint(c.BytesReceived, 10),
+	}
+}
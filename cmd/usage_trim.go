@@ -0,0 +1,140 @@
+/*
+Copyright © 2022 Tarmo Katmuk <tarmo.katmuk@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ceph/go-ceph/rgw/admin"
+	"github.com/spf13/cobra"
+)
+
+// trimUsageCmd represents the usage trim command
+var (
+	trimUsageCmd = &cobra.Command{
+		Use:   "trim",
+		Short: "Trim usage log",
+		Long: `Remove usage log entries older than --before, or older than the
+retention given with --keep.
+
+Keep the last 90 days of the usage log of all users:
+
+cephmgr rgw usage trim --keep 90d
+
+Trimming the usage log of all users asks for confirmation, unless --yes is
+given. Use --dry-run to show what would be removed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := trimUsage()
+			if err != nil {
+				fmt.Println(err)
+				cmd.Help()
+			}
+		},
+	}
+)
+
+func init() {
+	usageCmd.AddCommand(trimUsageCmd)
+
+	trimUsageCmd.Flags().StringVarP(&userName, "user", "u", "", "Trim only the usage log of user")
+	trimUsageCmd.Flags().StringVar(&usageBefore, "before", "", "Remove entries before time, YYYY-MM-DD[ HH:MM:SS]")
+	trimUsageCmd.Flags().StringVar(&usageKeep, "keep", "", "Remove entries older than duration, e.g. 90d")
+	trimUsageCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be removed")
+	trimUsageCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Trim without confirmation")
+}
+
+func trimUsage() error {
+	end, err := trimEnd(usageBefore, usageKeep, time.Now())
+	if err != nil {
+		return err
+	}
+
+	scope := "all users"
+	if userName != "" {
+		scope = "user " + userName
+	}
+	args := url.Values{"end": {end.Format(usageTimeFormat)}, "show-summary": {"false"}}
+	if userName != "" {
+		args.Set("uid", userName)
+	}
+	usage, err := getUsage(args)
+	if err != nil {
+		return err
+	}
+	entries := 0
+	for _, e := range usage.Entries {
+		entries += len(e.Buckets)
+	}
+	fmt.Fprintf(os.Stderr, "Usage log of %s before %s UTC: %d entries\n", scope, end.Format(usageTimeFormat), entries)
+
+	if dryRun {
+		return nil
+	}
+	if userName == "" && !assumeYes && !confirm("Trim the usage log of all users?") {
+		return errNotConfirmed
+	}
+
+	if userName != "" {
+		// go-ceph's TrimUsage has no uid parameter
+		args := url.Values{"uid": {userName}, "end": {end.Format(usageTimeFormat)}}
+		if _, err := adminCall(context.Background(), http.MethodDelete, "/usage", args); err != nil {
+			return err
+		}
+	} else {
+		c, err := admin.New(cephHost, cephAccessKey, cephAccessSecret, nil)
+		if err != nil {
+			return err
+		}
+		// RGW requires remove-all to trim all users without a start time
+		removeAll := true
+		err = c.TrimUsage(context.Background(), admin.Usage{End: end.Format(usageTimeFormat), RemoveAll: &removeAll})
+		if err != nil {
+			return err
+		}
+	}
+	if humanOutput() {
+		fmt.Printf("Trimmed usage log of %s before %s UTC\n", scope, end.Format(usageTimeFormat))
+	}
+	return nil
+}
+
+// trimEnd returns the end of the trimmed range from --before or --keep.
+func trimEnd(before, keep string, now time.Time) (time.Time, error) {
+	switch {
+	case before != "" && keep != "":
+		return time.Time{}, fmt.Errorf("%w, not both", errMissingTrimEnd)
+	case before != "":
+		return parseUsageTime(before)
+	case keep != "":
+		d, err := parseRetention(keep)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d).UTC().Truncate(time.Hour), nil
+	}
+	return time.Time{}, errMissingTrimEnd
+}
@@ -25,7 +25,8 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"text/tabwriter"
+	"strconv"
+	"strings"
 
 	"github.com/ceph/go-ceph/rgw/admin"
 	"github.com/spf13/cobra"
@@ -110,6 +111,7 @@ func init() {
 
 	userCmd.PersistentFlags().StringVarP(&userName, "user", "u", "", "Ceph user name")
 	userCmd.PersistentFlags().StringVarP(&userCaps, "caps", "", "", "User capabilities")
+	userCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "Show secret keys in output")
 	getuserCmd.MarkFlagRequired("user")
 	deleteCmd.MarkFlagRequired("user")
 }
@@ -120,19 +122,19 @@ func getUser(user User) error {
 		return err
 	}
 
-	u, err := c.GetUser(context.Background(), admin.User{ID: user.ID})
+	stats := true
+	u, err := c.GetUser(context.Background(), admin.User{ID: user.ID, GenerateStat: &stats})
 
 	if err != nil {
 		return err
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 10, 1, 5, ' ', 0)
-
-	fs := "%s\t%s\t%s\t%v\n"
-	fmt.Fprintln(w, "UID\tFull Name\tEmail\tCaps")
-	fmt.Fprintf(w, fs, u.ID, u.DisplayName, u.Email, u.Caps)
-	w.Flush()
-	return nil
+	var userdata User
+	if err := remarshal(u, &userdata); err != nil {
+		return err
+	}
+	maskUserSecrets(&userdata)
+	return printResource(userdata)
 }
 
 func listUsers() error {
@@ -147,10 +149,7 @@ func listUsers() error {
 		return err
 	}
 
-	for _, j := range *users {
-		fmt.Println(j)
-	}
-	return nil
+	return printResource(userList(*users))
 }
 
 func deleteUser(user User) error {
@@ -167,3 +166,73 @@ func deleteUser(user User) error {
 	}
 	return nil
 }
+
+type userList []string
+
+func (l userList) table() table {
+	t := table{headers: []string{"UID"}}
+	for _, id := range l {
+		t.rows = append(t.rows, []string{id})
+	}
+	return t
+}
+
+func (l userList) names() []string {
+	return l
+}
+
+func (u User) table() table {
+	return table{
+		headers: []string{"UID", "Full Name", "Email", "Caps", "Suspended", "Subusers", "Quota Size", "Quota Objects", "Max Buckets", "Keys"},
+		rows: [][]string{{
+			u.ID, u.DisplayName, u.Email, formatCaps(u.Caps), formatFlag(u.Suspended), formatSubusers(u.Subusers),
+			formatUserQuota(u.Stats.Size, u.UserQuota.Enabled, u.UserQuota.MaxSize, true),
+			formatUserQuota(u.Stats.NumObjects, u.UserQuota.Enabled, u.UserQuota.MaxObjects, false),
+			formatInt(u.MaxBuckets), strconv.Itoa(len(u.Keys)),
+		}},
+		wide: 2,
+	}
+}
+
+func (u User) names() []string {
+	return []string{u.ID}
+}
+
+func formatCaps(caps []UserCapSpec) string {
+	s := make([]string, 0, len(caps))
+	for _, c := range caps {
+		s = append(s, c.Type+"="+c.Perm)
+	}
+	return strings.Join(s, ";")
+}
+
+func formatSubusers(subusers []SubuserSpec) string {
+	s := make([]string, 0, len(subusers))
+	for _, su := range subusers {
+		s = append(s, su.ID+"("+su.Permissions+")")
+	}
+	return strings.Join(s, ",")
+}
+
+// formatUserQuota shows usage next to the quota limit, when the quota is enabled.
+func formatUserQuota(used *uint64, enabled *bool, limit *int64, size bool) string {
+	if enabled == nil || !*enabled {
+		disabled := int64(-1)
+		limit = &disabled
+	}
+	return formatUsage(used, limit, size)
+}
+
+func formatFlag(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.FormatBool(*i != 0)
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
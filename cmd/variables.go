@@ -1,12 +1,77 @@
 package cmd
 
+import "time"
+
 var (
 	cephHost         string
 	cephAccessKey    string
 	cephAccessSecret string
+	cephCluster      string
 	// cfgFile          string
-	userCaps     string
-	userEmail    string
-	userFullname string
-	userName     string
+	clusterAccessKey      string
+	clusterAccessSecret   string
+	clusterHostname       string
+	configRaw             bool
+	assumeYes             bool
+	keyAccessKey          string
+	keyGrace              time.Duration
+	keySecretKey          string
+	keyVerify             bool
+	outputFormat          string
+	secretFormat          string
+	secretOutputFile      string
+	showSecrets           bool
+	subuserAccess         string
+	subuserGenerateSecret bool
+	subuserKeepKeys       bool
+	subuserKeyType        string
+	subuserName           string
+	subuserSecret         string
+	userCaps              string
+	userDefaultPlacement  string
+	userEmail             string
+	userFullname          string
+	userMaxBuckets        int
+	userName              string
+	userOpMask            string
+	userSuspended         bool
+	usersFile             string
+	quotaMaxObjects       int64
+	quotaMaxSize          string
+	bucketName            string
+	quotaEnable           bool
+	bucketPurgeObjects    bool
+	bucketStats           bool
+	bucketOwner           string
+	bucketSort            string
+	bucketTop             int
+	usageStart            string
+	usageEnd              string
+	usageCategories       string
+	usageSummary          bool
+	usageBefore           string
+	usageKeep             string
+	dryRun                bool
+	reportMonth           string
+	manifestFiles         []string
+	diffColor             string
+	stateFile             string
+	stateEncrypt          bool
+	onConflict            string
+	bulkWorkers           int
+	resultFile            string
+	migrateFrom           string
+	migrateTo             string
+	migrateUIDs           []string
+	migrateKeepKeys       bool
+	syncSrc               string
+	syncDst               string
+	syncSrcUser           string
+	syncDstUser           string
+	syncDelete            bool
+	syncWorkers           int
+	syncCheckpointFile    string
+	s3User                string
+	s3Owner               bool
+	s3Recursive           bool
 )